@@ -0,0 +1,158 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const bcdUnpacked = "unpacked"
+
+func parseBCD(v string) (bool, error) {
+	switch strings.TrimSpace(v) {
+	case "", "packed":
+		return false, nil
+	case bcdUnpacked:
+		return true, nil
+	default:
+		return false, errors.New("invalid bcd " + v + ", expected packed or unpacked")
+	}
+}
+
+func checkBCDKind(fieldValue reflect.Value) error {
+	switch fieldValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.String:
+		return nil
+	default:
+		return errors.New(`bcd is not supported for type "` + fieldValue.Kind().String() + `"`)
+	}
+}
+
+// bcdDigits returns the number of decimal digits in n bytes.
+func bcdDigits(n int64, unpacked bool) int64 {
+	if unpacked {
+		return n
+	}
+	return 2 * n
+}
+
+// readBCD decodes length bytes of BCD digits, two per byte with the high
+// nibble first, or one per byte if unpacked. A string keeps all digits
+// including leading zeros.
+func readBCD(r Reader, fieldValue reflect.Value, fieldData *fieldReadData, length *int64) error {
+	err := checkBCDKind(fieldValue)
+	if err != nil {
+		return err
+	}
+
+	if length == nil {
+		return errors.New("need set tag with len for bcd")
+	}
+
+	_, b, err := r.ReadBytes(int(*length))
+	if err != nil {
+		return err
+	}
+
+	digits := make([]byte, 0, bcdDigits(*length, fieldData.Unpacked))
+	for i, c := range b {
+		nibbles := []byte{c >> 4, c & 0x0F}
+		if fieldData.Unpacked {
+			nibbles = []byte{c}
+		}
+
+		for _, d := range nibbles {
+			if d > 9 {
+				return fmt.Errorf("invalid bcd byte %#02x at index %d", c, i)
+			}
+			digits = append(digits, '0'+d)
+		}
+	}
+
+	if fieldValue.Kind() == reflect.String {
+		if fieldValue.CanSet() {
+			fieldValue.SetString(string(digits))
+		}
+		return nil
+	}
+
+	u, err := strconv.ParseUint(string(digits), 10, 64)
+	if err != nil {
+		return fmt.Errorf("bcd %s overflows %s", strings.TrimLeft(string(digits), "0"), fieldValue.Type())
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if fieldValue.OverflowUint(u) {
+			return fmt.Errorf("bcd %d overflows %s", u, fieldValue.Type())
+		}
+
+		if fieldValue.CanSet() {
+			fieldValue.SetUint(u)
+		}
+	default:
+		if u > math.MaxInt64 || fieldValue.OverflowInt(int64(u)) {
+			return fmt.Errorf("bcd %d overflows %s", u, fieldValue.Type())
+		}
+
+		if fieldValue.CanSet() {
+			fieldValue.SetInt(int64(u))
+		}
+	}
+
+	return nil
+}
+
+// writeBCD encodes an integer or a string of digits as length bytes of
+// BCD. Shorter values are padded with leading zeros.
+func writeBCD(w Writer, fieldValue reflect.Value, fieldData *fieldReadData, length *int64) error {
+	err := checkBCDKind(fieldValue)
+	if err != nil {
+		return err
+	}
+
+	if length == nil {
+		return errors.New("need set tag with len for bcd")
+	}
+
+	var digits string
+	switch fieldValue.Kind() {
+	case reflect.String:
+		digits = fieldValue.String()
+		for _, c := range digits {
+			if c < '0' || c > '9' {
+				return fmt.Errorf("bcd string %q contains non-digit %q", digits, c)
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		digits = strconv.FormatUint(fieldValue.Uint(), 10)
+	default:
+		if fieldValue.Int() < 0 {
+			return fmt.Errorf("negative value %d can't be encoded as bcd", fieldValue.Int())
+		}
+		digits = strconv.FormatInt(fieldValue.Int(), 10)
+	}
+
+	n := bcdDigits(*length, fieldData.Unpacked)
+	if int64(len(digits)) > n {
+		return fmt.Errorf("value %s does not fit in %d bcd digits", digits, n)
+	}
+	digits = strings.Repeat("0", int(n)-len(digits)) + digits
+
+	b := make([]byte, *length)
+	for i := range b {
+		if fieldData.Unpacked {
+			b[i] = digits[i] - '0'
+		} else {
+			b[i] = (digits[2*i]-'0')<<4 | (digits[2*i+1] - '0')
+		}
+	}
+
+	_, err = w.Write(b)
+	return err
+}
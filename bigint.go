@@ -0,0 +1,158 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+// Uint128 is an unsigned 128-bit integer field. It is 16 bytes in the
+// byte order of the reader, or len:N bytes.
+type Uint128 struct {
+	Hi, Lo uint64
+}
+
+// Uint128FromBig returns the low 128 bits of v.
+func Uint128FromBig(v *big.Int) Uint128 {
+	b := new(big.Int).And(v, uint128Mask).FillBytes(make([]byte, 16))
+	return Uint128{Hi: beUint64(b[:8]), Lo: beUint64(b[8:])}
+}
+
+// Big returns u as a big.Int.
+func (u Uint128) Big() *big.Int {
+	v := new(big.Int).SetUint64(u.Hi)
+	v.Lsh(v, 64)
+	return v.Or(v, new(big.Int).SetUint64(u.Lo))
+}
+
+func (u Uint128) String() string {
+	return u.Big().String()
+}
+
+// Int128 is a signed 128-bit integer field in two's complement. It is 16
+// bytes in the byte order of the reader, or len:N bytes.
+type Int128 struct {
+	Hi int64
+	Lo uint64
+}
+
+// Int128FromBig returns the low 128 bits of v in two's complement.
+func Int128FromBig(v *big.Int) Int128 {
+	u := Uint128FromBig(v)
+	return Int128{Hi: int64(u.Hi), Lo: u.Lo}
+}
+
+// Big returns i as a big.Int.
+func (i Int128) Big() *big.Int {
+	v := Uint128{Hi: uint64(i.Hi), Lo: i.Lo}.Big()
+	if i.Hi < 0 {
+		v.Sub(v, uint128Range)
+	}
+	return v
+}
+
+func (i Int128) String() string {
+	return i.Big().String()
+}
+
+var (
+	uint128Range = new(big.Int).Lsh(big.NewInt(1), 128)
+	uint128Mask  = new(big.Int).Sub(uint128Range, big.NewInt(1))
+
+	bigIntType  = reflect.TypeOf((*big.Int)(nil))
+	uint128Type = reflect.TypeOf(Uint128{})
+	int128Type  = reflect.TypeOf(Int128{})
+)
+
+func isBigIntType(t reflect.Type) bool {
+	return t == bigIntType || t == uint128Type || t == int128Type
+}
+
+// bigIntWidth returns the number of bytes of a big integer field. A
+// *big.Int needs a len tag, the 128-bit types are 16 bytes by default.
+func bigIntWidth(fieldValue reflect.Value, length *int64) (int, error) {
+	if length != nil {
+		if *length < 1 {
+			return 0, fmt.Errorf("len of a big integer must be positive, got %d", *length)
+		}
+		return int(*length), nil
+	}
+
+	if fieldValue.Type() == bigIntType {
+		return 0, errors.New("need set tag with len for *big.Int")
+	}
+	return 16, nil
+}
+
+// bigIntSigned reports whether a big integer field is two's complement.
+// A *big.Int is unsigned unless the signed tag is set.
+func bigIntSigned(fieldValue reflect.Value, fieldData *fieldReadData) bool {
+	return fieldValue.Type() == int128Type || fieldData.Signed
+}
+
+func readBigInt(r Reader, fieldValue reflect.Value, fieldData *fieldReadData, length *int64) error {
+	n, err := bigIntWidth(fieldValue, length)
+	if err != nil {
+		return err
+	}
+
+	signed := bigIntSigned(fieldValue, fieldData)
+	v, err := r.ReadBigInt(n, signed)
+	if err != nil {
+		return err
+	}
+
+	var value reflect.Value
+	switch fieldValue.Type() {
+	case uint128Type:
+		if v.BitLen() > 128 {
+			return fmt.Errorf("value %s overflows Uint128", v)
+		}
+		value = reflect.ValueOf(Uint128FromBig(v))
+	case int128Type:
+		if v.BitLen() > 127 && !isMinInt128(v) {
+			return fmt.Errorf("value %s overflows Int128", v)
+		}
+		value = reflect.ValueOf(Int128FromBig(v))
+	default:
+		value = reflect.ValueOf(v)
+	}
+
+	if fieldValue.CanSet() {
+		fieldValue.Set(value)
+	}
+	return nil
+}
+
+func writeBigInt(w Writer, fieldValue reflect.Value, fieldData *fieldReadData, length *int64) error {
+	n, err := bigIntWidth(fieldValue, length)
+	if err != nil {
+		return err
+	}
+
+	return w.WriteBigInt(bigIntValue(fieldValue), n, bigIntSigned(fieldValue, fieldData))
+}
+
+func bigIntValue(fieldValue reflect.Value) *big.Int {
+	switch fieldValue.Type() {
+	case uint128Type:
+		return fieldValue.Interface().(Uint128).Big()
+	case int128Type:
+		return fieldValue.Interface().(Int128).Big()
+	default:
+		return fieldValue.Interface().(*big.Int)
+	}
+}
+
+func isMinInt128(v *big.Int) bool {
+	return v.Sign() < 0 && v.BitLen() == 128 && v.TrailingZeroBits() == 127
+}
+
+func beUint64(b []byte) uint64 {
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u
+}
@@ -0,0 +1,87 @@
+package binstruct
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BigIntTypes(t *testing.T) {
+	u := Uint128{Hi: 0x0102030405060708, Lo: 0x090A0B0C0D0E0F10}
+	require.Equal(t, "0x102030405060708090a0b0c0d0e0f10", "0x"+u.Big().Text(16))
+	require.Equal(t, u, Uint128FromBig(u.Big()))
+
+	i := Int128{Hi: -1, Lo: 0xFFFFFFFFFFFFFFFE}
+	require.Equal(t, "-2", i.String())
+	require.Equal(t, i, Int128FromBig(big.NewInt(-2)))
+}
+
+func Test_BigIntTag(t *testing.T) {
+	type dataStruct struct {
+		ID    Uint128
+		Delta Int128   `bin:"le"`
+		Short Int128   `bin:"len:2"`
+		Hash  *big.Int `bin:"len:20"`
+		Diff  *big.Int `bin:"len:3,signed,le"`
+	}
+
+	data := []byte{
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F, 0x10,
+		0xFE, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0xFF, 0x9C,
+		0xFF, 0xEE, 0xDD, 0xCC, 0xBB, 0xAA, 0x99, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11, 0x00, 0x01, 0x02, 0x03, 0x04,
+		0x00, 0x00, 0x80,
+	}
+
+	hash, _ := new(big.Int).SetString("ffeeddccbbaa9988776655443322110001020304", 16)
+
+	want := dataStruct{
+		ID:    Uint128{Hi: 0x0102030405060708, Lo: 0x090A0B0C0D0E0F10},
+		Delta: Int128FromBig(big.NewInt(-2)),
+		Short: Int128FromBig(big.NewInt(-100)),
+		Hash:  hash,
+		Diff:  big.NewInt(-1 << 23),
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want.ID, actual.ID)
+	require.Equal(t, want.Delta, actual.Delta)
+	require.Equal(t, want.Short, actual.Short)
+	require.Equal(t, 0, want.Hash.Cmp(actual.Hash))
+	require.Equal(t, 0, want.Diff.Cmp(actual.Diff))
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_BigIntTagErrors(t *testing.T) {
+	_, err := MarshalBE(struct {
+		Value *big.Int `bin:"len:1"`
+	}{Value: big.NewInt(256)})
+	require.EqualError(t, err, `failed set value to field "Value": value 256 does not fit in 1 bytes`)
+
+	_, err = MarshalBE(struct {
+		Value *big.Int `bin:"len:1"`
+	}{Value: big.NewInt(-1)})
+	require.EqualError(t, err, `failed set value to field "Value": value -1 does not fit in 1 bytes`)
+
+	_, err = MarshalBE(struct {
+		Value *big.Int `bin:"len:1,signed"`
+	}{Value: big.NewInt(-129)})
+	require.EqualError(t, err, `failed set value to field "Value": value -129 does not fit in 1 bytes`)
+
+	_, err = MarshalBE(struct {
+		Value *big.Int
+	}{Value: big.NewInt(1)})
+	require.EqualError(t, err, `failed set value to field "Value": need set tag with len for *big.Int`)
+
+	var actual struct {
+		Value Uint128 `bin:"len:17"`
+	}
+	err = UnmarshalBE(append([]byte{0x01}, make([]byte, 16)...), &actual)
+	require.EqualError(t, err, `failed set value to field "Value": value 340282366920938463463374607431768211456 overflows Uint128`)
+}
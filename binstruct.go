@@ -1,6 +1,7 @@
 package binstruct
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 )
@@ -37,32 +38,36 @@ func Marshal(order binary.ByteOrder, v interface{}) ([]byte, error) {
 }
 
 type Encoder struct {
-	w     io.Writer
-	order binary.ByteOrder
-	debug bool
+	w        io.Writer
+	order    binary.ByteOrder
+	debug    bool
+	maxDepth int
 }
 
 // A Decoder reads and decodes binary values from an input stream.
 type Decoder struct {
-	r     io.ReadSeeker
-	order binary.ByteOrder
-	debug bool
+	r        io.ReadSeeker
+	order    binary.ByteOrder
+	debug    bool
+	maxDepth int
 }
 
 func NewEncoder(w io.Writer, order binary.ByteOrder) *Encoder {
 	return &Encoder{
-		w:     w,
-		order: order,
-		debug: false,
+		w:        w,
+		order:    order,
+		debug:    false,
+		maxDepth: DefaultMaxDepth,
 	}
 }
 
 // NewDecoder returns a new decoder that reads from r with byte order.
 func NewDecoder(r io.ReadSeeker, order binary.ByteOrder) *Decoder {
 	return &Decoder{
-		r:     r,
-		order: order,
-		debug: false,
+		r:        r,
+		order:    order,
+		debug:    false,
+		maxDepth: DefaultMaxDepth,
 	}
 }
 
@@ -76,14 +81,35 @@ func (dec *Decoder) SetDebug(debug bool) {
 	dec.debug = debug
 }
 
+// SetMaxDepth limits how deep structs can be nested in the input,
+// zero means no limit. The default is DefaultMaxDepth.
+func (dec *Decoder) SetMaxDepth(depth int) {
+	dec.maxDepth = depth
+}
+
 // Decode reads the binary-encoded value from its
 // input and stores it in the value pointed to by v.
 func (dec *Decoder) Decode(v interface{}) error {
-	return NewReader(dec.r, dec.order, dec.debug).Unmarshal(v)
+	r := &reader{
+		r:     dec.r,
+		order: dec.order,
+		bits:  &bitState{},
+		nest:  &nesting{max: dec.maxDepth},
+		debug: dec.debug,
+	}
+	return r.Unmarshal(v)
+}
+
+// SetMaxDepth limits how deep structs can be nested in the value,
+// zero means no limit. The default is DefaultMaxDepth.
+func (enc *Encoder) SetMaxDepth(depth int) {
+	enc.maxDepth = depth
 }
 
 // Decode reads the binary-encoded value from its
 // input and stores it in the value pointed to by v.
 func (dec *Encoder) Encode(v interface{}) ([]byte, error) {
-	return NewWriter(dec.order, dec.debug).Marshal(v)
+	w := newWriter(bytes.NewBuffer(make([]byte, 0, 1024)), dec.order, dec.debug)
+	w.nest.max = dec.maxDepth
+	return w.Marshal(v)
 }
@@ -2,6 +2,9 @@ package binstruct
 
 import (
 	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -891,3 +894,855 @@ func Test_LeAndBeInOneStruct(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, wantBE, actual)
 }
+
+func Test_IfTag(t *testing.T) {
+	type dataStruct struct {
+		Version   uint8
+		Flags     uint8
+		Timestamp uint32 `bin:"if:Version>=2"`
+		Extension []byte `bin:"if:Flags & 0x04 != 0, len:2"`
+		Checksum  uint16
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want dataStruct
+	}{
+		{
+			name: "all fields",
+			data: []byte{0x02, 0x04, 0x00, 0x00, 0x00, 0x2a, 0xaa, 0xbb, 0x12, 0x34},
+			want: dataStruct{Version: 2, Flags: 0x04, Timestamp: 42, Extension: []byte{0xaa, 0xbb}, Checksum: 0x1234},
+		},
+		{
+			name: "without optional fields",
+			data: []byte{0x01, 0x00, 0x12, 0x34},
+			want: dataStruct{Version: 1, Flags: 0x00, Checksum: 0x1234},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actual dataStruct
+			err := UnmarshalBE(tt.data, &actual)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, actual)
+
+			// Values of skipped fields are not written
+			actual.Timestamp = 42
+			got, err := MarshalBE(actual)
+			require.NoError(t, err)
+			require.Equal(t, tt.data, got)
+		})
+	}
+}
+
+func Test_MagicTag(t *testing.T) {
+	type dataStruct struct {
+		Header    [8]byte `bin:"magic:0x89504E470D0A1A0A"`
+		Signature uint32  `bin:"const:0x504b0304"`
+		Value     uint8
+	}
+
+	data := []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x50, 0x4b, 0x03, 0x04, 0x2a}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, dataStruct{
+		Header:    [8]byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a},
+		Signature: 0x504b0304,
+		Value:     0x2a,
+	}, actual)
+
+	// Constants are written regardless of the field values
+	got, err := MarshalLE(dataStruct{Value: 0x2a})
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_MagicTagMismatch(t *testing.T) {
+	type dataStruct struct {
+		Version   uint8
+		Signature [2]byte `bin:"magic:0x504B"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x01, 'P', 'X'}, &actual)
+	require.EqualError(t, err, `failed set value to field "Signature": binstruct: magic mismatch at offset 1: want 0x504b, got 0x5058`)
+
+	var magicErr *MagicMismatchError
+	require.True(t, errors.As(err, &magicErr))
+	require.Equal(t, int64(1), magicErr.Offset)
+}
+
+func Test_MagicTagInvalid(t *testing.T) {
+	type dataStruct struct {
+		Signature [2]byte `bin:"magic:0x5"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x05}, &actual)
+	require.EqualError(t, err, `failed parse ReadData from tags for field "Signature": invalid magic value 0x5, expected hex bytes like 0x504B`)
+}
+
+func Test_MagicTagSize(t *testing.T) {
+	type shortMagic struct {
+		Sig uint32 `bin:"magic:0x504B"`
+	}
+
+	_, err := MarshalBE(shortMagic{})
+	require.EqualError(t, err, `field "Sig": magic of 2 bytes doesn't match the 4-byte field`)
+
+	var actual shortMagic
+	err = UnmarshalBE([]byte{0x50, 0x4B, 0x03, 0x04}, &actual)
+	require.EqualError(t, err, `field "Sig": magic of 2 bytes doesn't match the 4-byte field`)
+
+	type dynamicMagic struct {
+		Size uint8
+		Sig  []byte `bin:"len:Size,magic:0x504B"`
+	}
+
+	_, err = MarshalBE(dynamicMagic{})
+	require.EqualError(t, err, `field "Sig": magic needs a field of fixed size, such as [4]byte or uint32`)
+
+	type sizedMagic struct {
+		Sig  uint32 `bin:"len:2,magic:0x504B"`
+		Name string `bin:"len:1+1,magic:0x4142"`
+	}
+
+	data := []byte{0x50, 0x4B, 0x41, 0x42}
+	var sized sizedMagic
+	err = UnmarshalBE(data, &sized)
+	require.NoError(t, err)
+	require.Equal(t, sizedMagic{Sig: 0x504B, Name: "AB"}, sized)
+
+	got, err := MarshalBE(sized)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_TermTag(t *testing.T) {
+	type dataStruct struct {
+		Name   string `bin:"cstring"`
+		Line   []byte `bin:"term:0x0A"`
+		Raw    string `bin:"term:0x0D0A,termInclude"`
+		Peeked string `bin:"term:0x3B,termNoConsume"`
+		Sep    byte
+	}
+
+	data := []byte{
+		'e', 'l', 'f', 0x00,
+		'l', 'o', 'g', 0x0a,
+		'r', 'a', 'w', 0x0d, 0x0a,
+		'a', 'b', ';',
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, dataStruct{
+		Name:   "elf",
+		Line:   []byte("log"),
+		Raw:    "raw\r\n",
+		Peeked: "ab",
+		Sep:    ';',
+	}, actual)
+
+	got, err := MarshalBE(actual)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_TermTagMaxLen(t *testing.T) {
+	type dataStruct struct {
+		Name string `bin:"cstring,maxLen:3"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{'a', 'b', 'c', 0x00}, &actual)
+	require.NoError(t, err)
+	require.Equal(t, "abc", actual.Name)
+
+	err = UnmarshalBE([]byte{'a', 'b', 'c', 'd', 0x00}, &actual)
+	var termErr *TerminatorNotFoundError
+	require.True(t, errors.As(err, &termErr))
+	require.EqualError(t, termErr, "binstruct: terminator 0x00 not found within 3 bytes")
+
+	_, err = MarshalBE(dataStruct{Name: "abcd"})
+	require.EqualError(t, err, `failed set value to field "Name": value length 4 is more than maxLen 3`)
+
+	_, err = MarshalBE(dataStruct{Name: "a\x00"})
+	require.EqualError(t, err, `failed set value to field "Name": value contains terminator 0x00`)
+}
+
+func Test_TermTagUnexpectedEOF(t *testing.T) {
+	type dataStruct struct {
+		Name string `bin:"cstring"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{'a', 'b'}, &actual)
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+func Test_PrefixTag(t *testing.T) {
+	type dataStruct struct {
+		Name  string   `bin:"prefix:u8"`
+		Blob  []byte   `bin:"prefix:u16"`
+		Items []uint16 `bin:"prefix:u32"`
+		Note  string   `bin:"prefix:varint"`
+	}
+
+	note := strings.Repeat("n", 200)
+	data := []byte{
+		0x02, 'h', 'i',
+		0x00, 0x03, 0x01, 0x02, 0x03,
+		0x00, 0x00, 0x00, 0x02, 0x00, 0x0a, 0x00, 0x0b,
+		0xc8, 0x01,
+	}
+	data = append(data, note...)
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	want := dataStruct{
+		Name:  "hi",
+		Blob:  []byte{0x01, 0x02, 0x03},
+		Items: []uint16{0x0a, 0x0b},
+		Note:  note,
+	}
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	length, err := calcLength(want, nil)
+	require.NoError(t, err)
+	require.Equal(t, len(data), length)
+}
+
+func Test_PrefixTagOverflow(t *testing.T) {
+	type dataStruct struct {
+		Name string `bin:"prefix:u8"`
+	}
+
+	_, err := MarshalBE(dataStruct{Name: strings.Repeat("a", 256)})
+	require.EqualError(t, err, `failed set value to field "Name": length 256 does not fit in prefix u8`)
+
+	type varintString struct {
+		Name string `bin:"prefix:varint"`
+	}
+
+	var actual varintString
+	err = UnmarshalBE([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x3f}, &actual)
+	require.EqualError(t, err, `failed set value to field "Name": prefix 4611686018427387903 is more than the 0 bytes left`)
+
+	err = UnmarshalBE([]byte{0x05, 'a', 'b'}, &actual)
+	require.EqualError(t, err, `failed set value to field "Name": prefix 5 is more than the 2 bytes left`)
+}
+
+func Test_PrefixTagInvalid(t *testing.T) {
+	type dataStruct struct {
+		Name string `bin:"prefix:u24"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x00}, &actual)
+	require.EqualError(t, err, `failed parse ReadData from tags for field "Name": invalid prefix u24, expected u8, u16, u32, u64 or varint`)
+}
+
+func Test_GreedyTag(t *testing.T) {
+	type record struct {
+		ID    uint8
+		Value uint16
+	}
+
+	type dataStruct struct {
+		Count   uint8
+		Records []record `bin:"len:*"`
+	}
+
+	data := []byte{0x02, 0x01, 0x00, 0x0a, 0x02, 0x00, 0x0b}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	want := dataStruct{
+		Count:   2,
+		Records: []record{{ID: 1, Value: 0x0a}, {ID: 2, Value: 0x0b}},
+	}
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_GreedyTagBytes(t *testing.T) {
+	type dataStruct struct {
+		Type uint8
+		Body []byte `bin:"greedy"`
+		Rest string `bin:"greedy"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x01, 'a', 'b'}, &actual)
+	require.NoError(t, err)
+	require.Equal(t, dataStruct{Type: 1, Body: []byte("ab"), Rest: ""}, actual)
+}
+
+func Test_GreedyTagPartialElement(t *testing.T) {
+	type dataStruct struct {
+		Values []uint16 `bin:"len:*"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x00, 0x01, 0x00}, &actual)
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+func Test_UntilTag(t *testing.T) {
+	type tlv struct {
+		Type  uint8
+		Len   uint8
+		Value []byte `bin:"len:Len"`
+	}
+
+	type dataStruct struct {
+		Entries []tlv    `bin:"until:Type==0"`
+		Values  []uint16 `bin:"until:_==0,untilExclude"`
+	}
+
+	data := []byte{
+		0x01, 0x02, 0xaa, 0xbb,
+		0x00, 0x00,
+		0x00, 0x05, 0x00, 0x06, 0x00, 0x00,
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	want := dataStruct{
+		Entries: []tlv{{Type: 1, Len: 2, Value: []byte{0xaa, 0xbb}}, {Type: 0, Len: 0}},
+		Values:  []uint16{5, 6},
+	}
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// The sentinel is written if it is missing
+	got, err = MarshalBE(dataStruct{Entries: []tlv{{Type: 1, Len: 2, Value: []byte{0xaa, 0xbb}}}, Values: []uint16{5, 6}})
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	length, err := calcLength(want, nil)
+	require.NoError(t, err)
+	require.Equal(t, len(data), length)
+}
+
+func Test_UntilTagSentinel(t *testing.T) {
+	type dataStruct struct {
+		Values []uint8  `bin:"until:_==0xFF,untilExclude"`
+		Words  []uint16 `bin:"until:0x1234==_"`
+		Rest   []int8   `bin:"until:_<0"`
+	}
+
+	data := []byte{
+		0x01, 0x02, 0xff,
+		0x00, 0x05, 0x12, 0x34,
+		0x07, 0xfe,
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, dataStruct{Values: []uint8{1, 2}, Words: []uint16{5, 0x1234}, Rest: []int8{7, -2}}, actual)
+
+	got, err := MarshalBE(actual)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// The sentinel of _==N is N, Marshal appends it to a slice without one
+	got, err = MarshalBE(dataStruct{Values: []uint8{1, 2}, Words: []uint16{5}, Rest: []int8{7, -2}})
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	_, err = MarshalBE(dataStruct{Rest: []int8{7}})
+	require.EqualError(t, err, `failed set value to field "Rest": last element does not match until and the zero value can't be used as the sentinel`)
+}
+
+func Test_UntilTagErrors(t *testing.T) {
+	type dataStruct struct {
+		Values []uint16 `bin:"until:_==0,untilExclude"`
+	}
+
+	_, err := MarshalBE(dataStruct{Values: []uint16{5, 0, 6}})
+	require.EqualError(t, err, `failed set value to field "Values": element 1 matches until, it would end the slice`)
+
+	var actual dataStruct
+	err = UnmarshalBE([]byte{0x00, 0x05}, &actual)
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+func Test_SizeTag(t *testing.T) {
+	type header struct {
+		Version uint8
+		Flags   uint8
+	}
+
+	type chunk struct {
+		ID      [2]byte
+		Len     uint16   `bin:"sizeOf:Body"`
+		Body    []uint16 `bin:"size:Len,len:*"`
+		HdrLen  uint8
+		Header  header `bin:"size:HdrLen,skipRest"`
+		Trailer uint8
+	}
+
+	data := []byte{
+		'a', 'b',
+		0x00, 0x04, 0x00, 0x01, 0x00, 0x02,
+		0x03, 0x01, 0x02, 0xff,
+		0x2a,
+	}
+
+	var actual chunk
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	want := chunk{
+		ID:      [2]byte{'a', 'b'},
+		Len:     4,
+		Body:    []uint16{1, 2},
+		HdrLen:  3,
+		Header:  header{Version: 1, Flags: 2},
+		Trailer: 0x2a,
+	}
+	require.Equal(t, want, actual)
+
+	// Len is filled from the encoded Body, the rest of Header is zero padded
+	want.Len = 0
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, []byte{
+		'a', 'b',
+		0x00, 0x04, 0x00, 0x01, 0x00, 0x02,
+		0x03, 0x01, 0x02, 0x00,
+		0x2a,
+	}, got)
+}
+
+func Test_SizeTagVariableElements(t *testing.T) {
+	type rec struct {
+		Len  uint8
+		Name string `bin:"len:Len"`
+	}
+
+	type dataStruct struct {
+		Size uint8   `bin:"sizeOf:Recs"`
+		Recs []rec   `bin:"size:Size,len:*"`
+		Tags [2]rec  // elements of an array can differ too
+		Pad  []uint8 `bin:"len:1,align:4"`
+	}
+
+	data := []byte{
+		0x06, 0x01, 'a', 0x03, 'a', 'b', 'c',
+		0x00, 0x02, 'x', 'y',
+		0x00, // align
+		0x09,
+	}
+
+	want := dataStruct{
+		Size: 6,
+		Recs: []rec{{1, "a"}, {3, "abc"}},
+		Tags: [2]rec{{0, ""}, {2, "xy"}},
+		Pad:  []uint8{9},
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	want.Size = 0 // filled by Marshal
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	length, err := calcLength(want, nil)
+	require.NoError(t, err)
+	require.Equal(t, len(data), length)
+}
+
+func Test_SizeTagErrors(t *testing.T) {
+	type header struct {
+		Version uint8
+		Flags   uint16
+	}
+
+	type dataStruct struct {
+		Len    uint8
+		Header header `bin:"size:Len"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x02, 0x01, 0x02, 0x03}, &actual)
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	require.EqualError(t, err, `failed set value to field "Header": field overruns its size of 2 bytes: unmarshal struct: failed set value to field "Flags": unexpected EOF`)
+
+	err = UnmarshalBE([]byte{0x04, 0x01, 0x02, 0x03, 0x04}, &actual)
+	require.EqualError(t, err, `failed set value to field "Header": field read 3 of its 4 bytes`)
+
+	_, err = MarshalBE(dataStruct{Len: 2, Header: header{Version: 1, Flags: 2}})
+	require.EqualError(t, err, `failed set value to field "Header": field encodes to 3 bytes, more than its size of 2`)
+}
+
+func Test_AlignAndPadTags(t *testing.T) {
+	type inner struct {
+		A uint8
+		B uint16 `bin:"alignStruct:2"`
+	}
+
+	type dataStruct struct {
+		Kind  uint8
+		Value uint32 `bin:"align:4,fill:0xff"`
+		Name  string `bin:"len:3,padTo:4"`
+		Flag  uint8  `bin:"pad:2"`
+		Inner inner
+	}
+
+	data := []byte{
+		0x01, 0xff, 0xff, 0xff,
+		0x00, 0x00, 0x00, 0x2a,
+		'a', 'b', 'c', 0x00,
+		0x01, 0x00, 0x00,
+		0x05, 0x00, 0x00, 0x06,
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	want := dataStruct{
+		Kind:  1,
+		Value: 0x2a,
+		Name:  "abc",
+		Flag:  1,
+		Inner: inner{A: 5, B: 6},
+	}
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	length, err := calcLength(want, nil)
+	require.NoError(t, err)
+	require.Equal(t, len(data), length)
+}
+
+func Test_AlignTagInvalid(t *testing.T) {
+	type dataStruct struct {
+		Value uint32 `bin:"align:0"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x00}, &actual)
+	require.EqualError(t, err, `failed parse ReadData from tags for field "Value": align must be a positive number, got 0`)
+}
+
+func Test_FixedStringTags(t *testing.T) {
+	type dataStruct struct {
+		Name  string `bin:"len:6,trim"`
+		Label string `bin:"len:4,fill:0x20,trim"`
+		Raw   string `bin:"len:3"`
+	}
+
+	data := []byte{
+		'a', 'b', 'c', 0x00, 0x00, 0x00,
+		'x', ' ', ' ', ' ',
+		'r', 0x00, 0x00,
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, dataStruct{Name: "abc", Label: "x", Raw: "r\x00\x00"}, actual)
+
+	got, err := MarshalBE(dataStruct{Name: "abc", Label: "x", Raw: "r"})
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_FixedStringPadTag(t *testing.T) {
+	type dataStruct struct {
+		Name string `bin:"len:16,pad:0x00,trim"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(make([]byte, 16), &actual)
+	require.EqualError(t, err, `failed parse ReadData from tags for field "Name": pad is a number of bytes after the field, got 0x00, set the fill byte of a string with fill`)
+}
+
+func Test_FixedStringTooLong(t *testing.T) {
+	type dataStruct struct {
+		Name string `bin:"len:4"`
+	}
+
+	_, err := MarshalBE(dataStruct{Name: "abcde"})
+	require.EqualError(t, err, `failed set value to field "Name": string length 5 is more than len 4`)
+
+	type truncated struct {
+		Name string `bin:"len:4,truncate"`
+	}
+
+	got, err := MarshalBE(truncated{Name: "abcde"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("abcd"), got)
+
+	// A multi-byte character is not split
+	got, err = MarshalBE(truncated{Name: "abcé"})
+	require.NoError(t, err)
+	require.Equal(t, []byte{'a', 'b', 'c', 0x00}, got)
+}
+
+func Test_MapTag(t *testing.T) {
+	type dataStruct struct {
+		Count  uint8
+		Names  map[string]uint16 `bin:"len:Count,key:[len:2],val:[le]"`
+		Labels map[uint8]string  `bin:"prefix:u8,val:[cstring]"`
+	}
+
+	data := []byte{
+		0x02,
+		'a', 'b', 0x01, 0x00,
+		'c', 'd', 0x02, 0x00,
+		0x02,
+		0x01, 'x', 0x00,
+		0x07, 'y', 'z', 0x00,
+	}
+
+	want := dataStruct{
+		Count:  2,
+		Names:  map[string]uint16{"ab": 1, "cd": 2},
+		Labels: map[uint8]string{1: "x", 7: "yz"},
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	// Keys are written in sorted order
+	for i := 0; i < 10; i++ {
+		got, err := MarshalBE(want)
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+	}
+}
+
+func Test_MapTagErrors(t *testing.T) {
+	type dataStruct struct {
+		Names map[uint8]uint8 `bin:"len:2"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x01, 0x0A, 0x01, 0x0B}, &actual)
+	require.EqualError(t, err, `failed set value to field "Names": duplicate key 1`)
+
+	_, err = MarshalBE(dataStruct{Names: map[uint8]uint8{1: 1}})
+	require.EqualError(t, err, `failed set value to field "Names": map has 1 entries, len is 2`)
+
+	// A huge count is not allocated up front
+	type prefixed struct {
+		Names map[uint32]uint32 `bin:"prefix:u32"`
+	}
+
+	err = UnmarshalBE([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x00, 0x01}, &prefixed{})
+	require.True(t, errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF), err)
+
+	type noLength struct {
+		Names map[uint8]uint8
+	}
+
+	err = UnmarshalBE([]byte{0x01}, &noLength{})
+	require.EqualError(t, err, `failed set value to field "Names": need set tag with len or prefix for map`)
+}
+
+func Test_VarintTag(t *testing.T) {
+	type dataStruct struct {
+		Length uint32 `bin:"varint"`
+		Offset int64  `bin:"zigzag"`
+		ID     int32  `bin:"varint"` // two's complement like protobuf int32
+		Name   string `bin:"len:Length"`
+	}
+
+	data := []byte{
+		0x03,
+		0x81, 0x01, // -65
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, // -1
+		'a', 'b', 'c',
+	}
+
+	want := dataStruct{Length: 3, Offset: -65, ID: -1, Name: "abc"}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_VarintTagErrors(t *testing.T) {
+	type dataStruct struct {
+		Value uint8 `bin:"varint"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0xac, 0x02}, &actual)
+	require.EqualError(t, err, `failed set value to field "Value": varint 300 overflows uint8`)
+
+	err = UnmarshalBE([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, &actual)
+	require.True(t, errors.Is(err, ErrVarintOverflow))
+
+	type zigzagUnsigned struct {
+		Value uint16 `bin:"zigzag"`
+	}
+
+	_, err = MarshalBE(zigzagUnsigned{Value: 1})
+	require.EqualError(t, err, `failed set value to field "Value": zigzag is not supported for type "uint16"`)
+
+	type withLen struct {
+		Value int `bin:"varint,len:4"`
+	}
+
+	_, err = MarshalBE(withLen{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "varint can't be used with len or bits")
+}
+
+func Test_BCDTag(t *testing.T) {
+	type dataStruct struct {
+		Counter uint16 `bin:"len:2,bcd"`
+		Year    int    `bin:"len:4,bcd:unpacked"`
+		Serial  string `bin:"len:3,bcd"`
+	}
+
+	data := []byte{
+		0x25, 0x19,
+		0x02, 0x00, 0x02, 0x04,
+		0x00, 0x12, 0x34,
+	}
+
+	want := dataStruct{Counter: 2519, Year: 2024, Serial: "001234"}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// Shorter values get leading zeros
+	got, err = MarshalBE(dataStruct{Counter: 7, Year: 24, Serial: "1234"})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x00, 0x07, 0x00, 0x00, 0x02, 0x04, 0x00, 0x12, 0x34}, got)
+}
+
+func Test_BCDTagErrors(t *testing.T) {
+	type dataStruct struct {
+		Value uint8 `bin:"len:2,bcd"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x12, 0x3A}, &actual)
+	require.EqualError(t, err, `failed set value to field "Value": invalid bcd byte 0x3a at index 1`)
+
+	err = UnmarshalBE([]byte{0x02, 0x56}, &actual)
+	require.EqualError(t, err, `failed set value to field "Value": bcd 256 overflows uint8`)
+
+	_, err = MarshalBE(struct {
+		Value uint16 `bin:"len:1,bcd"`
+	}{Value: 100})
+	require.EqualError(t, err, `failed set value to field "Value": value 100 does not fit in 2 bcd digits`)
+
+	_, err = MarshalBE(struct {
+		Value int16 `bin:"len:2,bcd"`
+	}{Value: -1})
+	require.EqualError(t, err, `failed set value to field "Value": negative value -1 can't be encoded as bcd`)
+
+	_, err = MarshalBE(struct {
+		Value string `bin:"len:2,bcd"`
+	}{Value: "12a4"})
+	require.EqualError(t, err, `failed set value to field "Value": bcd string "12a4" contains non-digit 'a'`)
+}
+
+func Test_ScaleTag(t *testing.T) {
+	type dataStruct struct {
+		Lon   float64 `bin:"len:4,scale:1e-6"`
+		Temp  float32 `bin:"len:1,unsigned,bias:-40"`
+		Volts float64 `bin:"len:2,unsigned,scale:0.01,round:down"`
+		Gain  float64 `bin:"fixed:16.16"`
+		Ratio float32 `bin:"fixed:0.8,unsigned"`
+	}
+
+	data := []byte{
+		0x06, 0xb6, 0x36, 0xb8, // 112.604856
+		0x41,       // 65 - 40
+		0x01, 0x4a, // 330 * 0.01
+		0xff, 0xfe, 0x80, 0x00, // -1.5
+		0xc0, // 0.75
+	}
+
+	want := dataStruct{Lon: 112.604856, Temp: 25, Volts: 3.3, Gain: -1.5, Ratio: 0.75}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.InDelta(t, want.Lon, actual.Lon, 1e-9)
+	require.Equal(t, want.Temp, actual.Temp)
+	require.InDelta(t, want.Volts, actual.Volts, 1e-9)
+	require.Equal(t, want.Gain, actual.Gain)
+	require.Equal(t, want.Ratio, actual.Ratio)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// round:down keeps 3.299 at 329, the default rounds to nearest
+	got, err = MarshalBE(dataStruct{Lon: 0.0000014, Volts: 3.299})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x00, 0x00, 0x00, 0x01}, got[:4])
+	require.Equal(t, []byte{0x01, 0x49}, got[5:7])
+}
+
+func Test_ScaleTagErrors(t *testing.T) {
+	type dataStruct struct {
+		Temp float64 `bin:"len:1,bias:-40"`
+	}
+
+	_, err := MarshalBE(dataStruct{Temp: 100})
+	require.EqualError(t, err, `failed set value to field "Temp": value 100 is out of range for 1 bytes`)
+
+	_, err = MarshalBE(struct {
+		Level float32 `bin:"len:1,unsigned,scale:0.5"`
+	}{Level: -1})
+	require.EqualError(t, err, `failed set value to field "Level": value -1 is out of range for 1 bytes`)
+
+	_, err = MarshalBE(struct {
+		Value float64 `bin:"scale:2"`
+	}{})
+	require.EqualError(t, err, `failed set value to field "Value": need set tag with len or fixed for scale and bias`)
+
+	_, err = MarshalBE(struct {
+		Value float64 `bin:"fixed:12.3"`
+	}{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "fixed must be like 16.16 with a multiple of 8 bits up to 64, got 12.3")
+}
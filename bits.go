@@ -0,0 +1,239 @@
+package binstruct
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// BitOrder specifies in which order bit-fields are packed.
+type BitOrder int
+
+const (
+	// MSBFirst packs the first field into the most significant bits
+	MSBFirst BitOrder = iota
+	// LSBFirst packs the first field into the least significant bits
+	LSBFirst
+)
+
+func (o BitOrder) String() string {
+	if o == LSBFirst {
+		return "LSBFirst"
+	}
+	return "MSBFirst"
+}
+
+// bitState is the partially read or written byte of a reader or writer.
+// Readers and writers made with WithOrder or WithBitOrder use the same
+// stream as their parent, so they share its bitState.
+type bitState struct {
+	buf   byte
+	count int
+}
+
+// bitGroup is a run of consecutive bit-field members that share one
+// underlying integer. The integer is as many bytes wide as needed to hold
+// all members and is read and written with the byte order of the first
+// member; unused bits are zero.
+type bitGroup struct {
+	fields []int // indexes into structPlan.fields
+	size   int   // bytes
+	order  binary.ByteOrder
+	bitOrd BitOrder
+}
+
+// compileBitGroups joins consecutive fields tagged with bits into groups.
+func compileBitGroups(t reflect.Type, p *structPlan) error {
+	for i := 0; i < len(p.fields); {
+		first := p.fields[i].data
+		if first.Bits == 0 {
+			i++
+			continue
+		}
+
+		g := &bitGroup{
+			order:  first.Order,
+			bitOrd: first.BitOrder,
+		}
+
+		total := 0
+		for ; i < len(p.fields) && p.fields[i].data.Bits > 0; i++ {
+			f := p.fields[i]
+			switch t.Field(f.index).Type.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Bool:
+			default:
+				return fmt.Errorf(`bit-field "%s" must be an integer or bool`, f.name)
+			}
+
+			err := checkBitFieldTags(f, first)
+			if err != nil {
+				return err
+			}
+
+			g.fields = append(g.fields, i)
+			total += f.data.Bits
+		}
+
+		if total > 64 {
+			return fmt.Errorf(`bit-fields starting at field "%s" use %d bits, more than 64`, p.fields[g.fields[0]].name, total)
+		}
+
+		g.size = (total + 7) / 8
+		p.fields[g.fields[0]].bitGroup = g
+	}
+
+	return nil
+}
+
+// checkBitFieldTags checks that a bit-field member has no tags the group
+// would ignore. The byte order and bit order of a group are those of its
+// first member, later members may only repeat them.
+func checkBitFieldTags(f fieldPlan, first *fieldReadData) error {
+	rest := *f.data
+	rest.Bits = 0
+
+	if f.data != first {
+		if rest.HasBitOrder && rest.BitOrder != first.BitOrder {
+			return fmt.Errorf(`bit-field "%s" has bit order %s, the group started with %s`, f.name, rest.BitOrder, first.BitOrder)
+		}
+		if rest.Order != nil && rest.Order != first.Order {
+			return fmt.Errorf(`bit-field "%s" has a byte order other than the first field of the group`, f.name)
+		}
+	}
+	rest.BitOrder, rest.HasBitOrder, rest.Order = 0, false, nil
+
+	if !reflect.DeepEqual(rest, fieldReadData{}) {
+		return fmt.Errorf(`bit-field "%s" supports only the bits tag and byte and bit order tags`, f.name)
+	}
+	return nil
+}
+
+// unpack splits the underlying integer into the member values.
+func (g *bitGroup) unpack(raw uint64, p *structPlan, structValue reflect.Value) {
+	pos := g.size * 8
+	if g.bitOrd == LSBFirst {
+		pos = 0
+	}
+
+	for _, idx := range g.fields {
+		f := p.fields[idx]
+		n := f.data.Bits
+
+		if g.bitOrd == LSBFirst {
+			setBitsValue(structValue.Field(f.index), (raw>>pos)&bitMask(n), n)
+			pos += n
+		} else {
+			pos -= n
+			setBitsValue(structValue.Field(f.index), (raw>>pos)&bitMask(n), n)
+		}
+	}
+}
+
+// pack joins the member values into the underlying integer.
+func (g *bitGroup) pack(p *structPlan, structValue reflect.Value) (uint64, error) {
+	var raw uint64
+
+	pos := g.size * 8
+	if g.bitOrd == LSBFirst {
+		pos = 0
+	}
+
+	for _, idx := range g.fields {
+		f := p.fields[idx]
+		n := f.data.Bits
+
+		v, err := getBitsValue(structValue.Field(f.index), n)
+		if err != nil {
+			return 0, fmt.Errorf(`failed set value to field "%s": %w`, f.name, err)
+		}
+
+		if g.bitOrd == LSBFirst {
+			raw |= v << pos
+			pos += n
+		} else {
+			pos -= n
+			raw |= v << pos
+		}
+	}
+
+	return raw, nil
+}
+
+func (u *unmarshal) readBitGroup(p *structPlan, g *bitGroup, structValue reflect.Value) error {
+	r := u.r
+	if g.order != nil {
+		r = r.WithOrder(g.order)
+	}
+
+	raw, err := r.ReadUintX(g.size)
+	if err != nil {
+		return fmt.Errorf(`failed set value to field "%s": %w`, p.fields[g.fields[0]].name, err)
+	}
+
+	g.unpack(raw, p, structValue)
+	return nil
+}
+
+func (m *marshal) writeBitGroup(p *structPlan, g *bitGroup, structValue reflect.Value) error {
+	w := m.w
+	if g.order != nil {
+		w = w.WithOrder(g.order)
+	}
+
+	raw, err := g.pack(p, structValue)
+	if err != nil {
+		return err
+	}
+
+	return w.WriteUintX(raw, g.size)
+}
+
+func bitMask(n int) uint64 {
+	if n >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<uint(n) - 1
+}
+
+func setBitsValue(v reflect.Value, bits uint64, n int) {
+	if !v.CanSet() {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(bits != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Sign extend from n bits
+		v.SetInt(int64(bits<<(64-uint(n))) >> (64 - uint(n)))
+	default:
+		v.SetUint(bits)
+	}
+}
+
+func getBitsValue(v reflect.Value, n int) (uint64, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if n < 64 && (i < -(1<<(uint(n)-1)) || i >= 1<<(uint(n)-1)) {
+			return 0, fmt.Errorf("value %d does not fit in %d bits", i, n)
+		}
+		return uint64(i) & bitMask(n), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := v.Uint()
+		if u&^bitMask(n) != 0 {
+			return 0, fmt.Errorf("value %d does not fit in %d bits", u, n)
+		}
+		return u, nil
+	default:
+		return 0, errors.New(`type "` + v.Kind().String() + `" not supported for bit-field`)
+	}
+}
@@ -0,0 +1,149 @@
+package binstruct
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BitFields(t *testing.T) {
+	// IPv4 header start: version 4, IHL 5, DSCP 46, ECN 1, total length 84
+	data := []byte{0x45, 0xb9, 0x00, 0x54}
+
+	type dataStruct struct {
+		Version uint8  `bin:"bits:4"`
+		IHL     uint8  `bin:"bits:4"`
+		DSCP    uint8  `bin:"bits:6"`
+		ECN     uint8  `bin:"bits:2"`
+		Length  uint16 // regular field after the group
+	}
+
+	want := dataStruct{Version: 4, IHL: 5, DSCP: 46, ECN: 1, Length: 84}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(actual)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_BitFieldsLSBFirst(t *testing.T) {
+	// 16-bit little-endian word 0xB3C5 = 1011 0011 1100 0101
+	data := []byte{0xc5, 0xb3}
+
+	type dataStruct struct {
+		Color   uint8 `bin:"bits:3,lsb"` // 101
+		Blink   bool  `bin:"bits:1"`     // 0
+		Offset  int8  `bin:"bits:5"`     // 11100 -> -4
+		Reserve uint8 `bin:"bits:7"`     // 1011001
+	}
+
+	want := dataStruct{Color: 5, Blink: false, Offset: -4, Reserve: 0x59}
+
+	var actual dataStruct
+	err := UnmarshalLE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	got, err := MarshalLE(actual)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_BitFieldsPartialByte(t *testing.T) {
+	type dataStruct struct {
+		Flag  bool  `bin:"bits:1"`
+		Mode  uint8 `bin:"bits:2"`
+		Value uint8
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0xdf, 0x2a}, &actual)
+	require.NoError(t, err)
+	require.Equal(t, dataStruct{Flag: true, Mode: 2, Value: 0x2a}, actual)
+
+	// Unused bits are written as zero
+	got, err := MarshalBE(actual)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xc0, 0x2a}, got)
+}
+
+func Test_BitFieldsOverflow(t *testing.T) {
+	type dataStruct struct {
+		A uint8 `bin:"bits:3"`
+		B int8  `bin:"bits:5"`
+	}
+
+	_, err := MarshalBE(dataStruct{A: 8})
+	require.EqualError(t, err, `failed set value to field "A": value 8 does not fit in 3 bits`)
+
+	_, err = MarshalBE(dataStruct{B: -17})
+	require.EqualError(t, err, `failed set value to field "B": value -17 does not fit in 5 bits`)
+}
+
+func Test_BitFieldsInvalid(t *testing.T) {
+	type tooWide struct {
+		A uint64 `bin:"bits:60"`
+		B uint8  `bin:"bits:5"`
+	}
+
+	var actual tooWide
+	err := UnmarshalBE(make([]byte, 9), &actual)
+	require.EqualError(t, err, `bit-fields starting at field "A" use 65 bits, more than 64`)
+
+	type notInteger struct {
+		S string `bin:"bits:4"`
+	}
+
+	var actual2 notInteger
+	err = UnmarshalBE([]byte{0x00}, &actual2)
+	require.EqualError(t, err, `bit-field "S" must be an integer or bool`)
+}
+
+func Test_BitFieldsMemberTags(t *testing.T) {
+	type withIf struct {
+		Flag uint8
+		A    uint8 `bin:"bits:4"`
+		B    uint8 `bin:"bits:4,if:Flag"`
+	}
+
+	_, err := MarshalBE(withIf{})
+	require.EqualError(t, err, `bit-field "B" supports only the bits tag and byte and bit order tags`)
+
+	type withLen struct {
+		A uint8 `bin:"bits:4,len:1"`
+		B uint8 `bin:"bits:4"`
+	}
+
+	_, err = MarshalBE(withLen{})
+	require.EqualError(t, err, `bit-field "A" supports only the bits tag and byte and bit order tags`)
+
+	type mixedBitOrder struct {
+		A uint8 `bin:"bits:4,lsb"`
+		B uint8 `bin:"bits:4,msb"`
+	}
+
+	var actual mixedBitOrder
+	err = UnmarshalBE([]byte{0x00}, &actual)
+	require.EqualError(t, err, `bit-field "B" has bit order MSBFirst, the group started with LSBFirst`)
+
+	type mixedByteOrder struct {
+		A uint16 `bin:"bits:8,le"`
+		B uint16 `bin:"bits:8,be"`
+	}
+
+	_, err = MarshalBE(mixedByteOrder{})
+	require.EqualError(t, err, `bit-field "B" has a byte order other than the first field of the group`)
+
+	type repeated struct {
+		A uint16 `bin:"bits:4,lsb,le"`
+		B uint16 `bin:"bits:12,lsb,le"`
+	}
+
+	got, err := MarshalBE(repeated{A: 0x1, B: 0xabc})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xc1, 0xab}, got)
+}
@@ -0,0 +1,179 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TextDecoder converts encoded bytes of a string field to a Go string.
+type TextDecoder func(b []byte) (string, error)
+
+// TextEncoder converts a Go string to the encoded bytes of a string field.
+type TextEncoder func(s string) ([]byte, error)
+
+type textEncoding struct {
+	decode TextDecoder
+	encode TextEncoder
+	unit   int // bytes per code unit, terminators and padding are whole units
+}
+
+var textEncodings sync.Map // name -> *textEncoding
+
+// RegisterTextEncoding registers a character encoding for string fields
+// tagged with bin:"enc:name". The decoder is used by Unmarshal and the
+// encoder by Marshal. Lengths, prefixes and terminators apply to the
+// encoded bytes.
+//
+//	binstruct.RegisterTextEncoding("gbk",
+//		func(b []byte) (string, error) { s, err := gbk.NewDecoder().Bytes(b); return string(s), err },
+//		func(s string) ([]byte, error) { return gbk.NewEncoder().Bytes([]byte(s)) },
+//	)
+//
+// The encodings utf16le, utf16be and latin1 are built in.
+func RegisterTextEncoding(name string, decoder TextDecoder, encoder TextEncoder) {
+	if decoder == nil || encoder == nil {
+		panic("binstruct: RegisterTextEncoding " + name + " needs a decoder and an encoder")
+	}
+
+	textEncodings.Store(name, &textEncoding{decode: decoder, encode: encoder, unit: 1})
+}
+
+func init() {
+	textEncodings.Store("utf16le", &textEncoding{decode: decodeUTF16(false), encode: encodeUTF16(false), unit: 2})
+	textEncodings.Store("utf16be", &textEncoding{decode: decodeUTF16(true), encode: encodeUTF16(true), unit: 2})
+	textEncodings.Store("latin1", &textEncoding{decode: decodeLatin1, encode: encodeLatin1, unit: 1})
+}
+
+// getTextEncoding returns the encoding registered under name, or nil for
+// plain strings.
+func getTextEncoding(name string) (*textEncoding, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	enc, ok := textEncodings.Load(name)
+	if !ok {
+		return nil, errors.New("text encoding " + name + " is not registered, use binstruct.RegisterTextEncoding")
+	}
+	return enc.(*textEncoding), nil
+}
+
+func (e *textEncoding) unitSize() int {
+	if e == nil {
+		return 1
+	}
+	return e.unit
+}
+
+// checkStringUnits checks that a string with a constant len holds whole
+// code units of its encoding. Other lengths are checked by Marshal.
+func checkStringUnits(t reflect.Type, fieldData *fieldReadData) error {
+	if fieldData == nil {
+		return nil
+	}
+
+	if fieldData.Sized != nil {
+		fieldData = fieldData.Sized
+	}
+
+	switch t.Kind() {
+	case reflect.Array, reflect.Slice:
+		return checkStringUnits(t.Elem(), fieldData.ElemFieldData)
+	case reflect.String:
+	default:
+		return nil
+	}
+
+	if fieldData.Length == nil || fieldData.Terminator != nil {
+		return nil
+	}
+
+	n, ok := constValue(fieldData.Length)
+	if !ok {
+		return nil
+	}
+
+	// An unknown encoding is reported when the field is read or written
+	enc, err := getTextEncoding(fieldData.Encoding)
+	if err != nil {
+		return nil
+	}
+	return checkUnits(n, enc)
+}
+
+func checkUnits(n int64, enc *textEncoding) error {
+	if unit := int64(enc.unitSize()); n%unit != 0 {
+		return fmt.Errorf("len %d is not a whole number of %d-byte code units", n, unit)
+	}
+	return nil
+}
+
+func (e *textEncoding) decodeString(b []byte) (string, error) {
+	if e == nil {
+		return string(b), nil
+	}
+	return e.decode(b)
+}
+
+func (e *textEncoding) encodeString(s string) ([]byte, error) {
+	if e == nil {
+		return []byte(s), nil
+	}
+	return e.encode(s)
+}
+
+func decodeUTF16(bigEndian bool) TextDecoder {
+	return func(b []byte) (string, error) {
+		if len(b)%2 != 0 {
+			return "", fmt.Errorf("odd number of bytes %d for utf16", len(b))
+		}
+
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			if bigEndian {
+				units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+			} else {
+				units[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+			}
+		}
+		return string(utf16.Decode(units)), nil
+	}
+}
+
+func encodeUTF16(bigEndian bool) TextEncoder {
+	return func(s string) ([]byte, error) {
+		units := utf16.Encode([]rune(s))
+		b := make([]byte, 0, 2*len(units))
+		for _, u := range units {
+			if bigEndian {
+				b = append(b, byte(u>>8), byte(u))
+			} else {
+				b = append(b, byte(u), byte(u>>8))
+			}
+		}
+		return b, nil
+	}
+}
+
+func decodeLatin1(b []byte) (string, error) {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r), nil
+}
+
+func encodeLatin1(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF || r == utf8.RuneError {
+			return nil, fmt.Errorf("character %q can't be encoded in latin1", r)
+		}
+		b = append(b, byte(r))
+	}
+	return b, nil
+}
@@ -0,0 +1,96 @@
+package binstruct
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EncTag(t *testing.T) {
+	type dataStruct struct {
+		Name   string `bin:"enc:utf16le,cstring"`
+		Title  string `bin:"enc:utf16be,prefix:u8"`
+		Label  string `bin:"enc:utf16le,len:8,trim"`
+		Legacy string `bin:"enc:latin1,len:3"`
+	}
+
+	data := []byte{
+		'a', 0x00, 0x00, 0x01, 0x00, 0x00, // "aĀ" and the zero code unit
+		0x04, 0x00, 'h', 0x00, 'i',
+		'o', 0x00, 'k', 0x00, 0x00, 0x00, 0x00, 0x00,
+		'c', 'a', 0xe9,
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	want := dataStruct{Name: "aĀ", Title: "hi", Label: "ok", Legacy: "caé"}
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	length, err := calcLength(want, nil)
+	require.NoError(t, err)
+	require.Equal(t, len(data), length)
+}
+
+func Test_EncTagErrors(t *testing.T) {
+	type latin1 struct {
+		Name string `bin:"enc:latin1,len:2"`
+	}
+
+	_, err := MarshalBE(latin1{Name: "日"})
+	require.EqualError(t, err, `failed set value to field "Name": character '日' can't be encoded in latin1`)
+
+	type unknown struct {
+		Name string `bin:"enc:ebcdic,len:2"`
+	}
+
+	var actual unknown
+	err = UnmarshalBE([]byte{0x00, 0x00}, &actual)
+	require.EqualError(t, err, `failed set value to field "Name": text encoding ebcdic is not registered, use binstruct.RegisterTextEncoding`)
+}
+
+func Test_EncTagOddLen(t *testing.T) {
+	type constLen struct {
+		Name string `bin:"len:5,enc:utf16le,truncate,trim"`
+	}
+
+	_, err := MarshalBE(constLen{Name: "abc"})
+	require.EqualError(t, err, `field "Name": len 5 is not a whole number of 2-byte code units`)
+
+	type dynamicLen struct {
+		Len  uint8
+		Name string `bin:"len:Len,enc:utf16be"`
+	}
+
+	_, err = MarshalBE(dynamicLen{Len: 3, Name: "a"})
+	require.EqualError(t, err, `failed set value to field "Name": len 3 is not a whole number of 2-byte code units`)
+
+	got, err := MarshalBE(dynamicLen{Len: 4, Name: "a"})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x04, 0x00, 'a', 0x00, 0x00}, got)
+}
+
+func Test_RegisterTextEncoding(t *testing.T) {
+	RegisterTextEncoding("upper",
+		func(b []byte) (string, error) { return string(bytes.ToLower(b)), nil },
+		func(s string) ([]byte, error) { return bytes.ToUpper([]byte(s)), nil },
+	)
+
+	type dataStruct struct {
+		Name string `bin:"enc:upper,len:4,truncate"`
+	}
+
+	got, err := MarshalBE(dataStruct{Name: "abcdef"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("ABCD"), got)
+
+	var actual dataStruct
+	err = UnmarshalBE(got, &actual)
+	require.NoError(t, err)
+	require.Equal(t, "abcd", actual.Name)
+}
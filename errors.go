@@ -2,9 +2,31 @@ package binstruct
 
 import (
 	"errors"
+	"fmt"
 	"io"
 )
 
+// MagicMismatchError is returned by Unmarshal when the bytes of a field
+// tagged with magic (or const) differ from the expected constant.
+type MagicMismatchError struct {
+	Offset int64 // position of the first byte of the field
+	Want   []byte
+	Got    []byte
+}
+
+func (e *MagicMismatchError) Error() string {
+	return fmt.Sprintf("binstruct: magic mismatch at offset %d: want %#x, got %#x", e.Offset, e.Want, e.Got)
+}
+
+// ErrMaxDepth is returned when structs are nested deeper than the
+// maximum depth, see DefaultMaxDepth, Decoder.SetMaxDepth and
+// Encoder.SetMaxDepth.
+var ErrMaxDepth = errors.New("binstruct: maximum nesting depth exceeded")
+
+// ErrVarintOverflow is returned when a varint is longer than 10 bytes or
+// its value does not fit in 64 bits.
+var ErrVarintOverflow = errors.New("binstruct: varint overflows a 64-bit integer")
+
 // Deprecated: use errors.Is(err, io.EOF)
 // IsEOF checks that the error is EOF
 func IsEOF(err error) bool {
@@ -16,3 +38,23 @@ func IsEOF(err error) bool {
 func IsUnexpectedEOF(err error) bool {
 	return errors.Is(err, io.ErrUnexpectedEOF)
 }
+
+// wrapError returns err with context, like fmt.Errorf with %w. Errors of
+// the depth limit are returned as they are, see fieldError.
+func wrapError(err error, format string, args ...any) error {
+	if errors.Is(err, ErrMaxDepth) {
+		return err
+	}
+	return fmt.Errorf(format+": %w", append(args, err)...)
+}
+
+// fieldError returns err with the name of the field it happened in. An
+// error of the depth limit is named by the innermost field only and passed
+// up unchanged from there, so input nested up to the limit can't build an
+// error as long as its path.
+func fieldError(err error, format, name string) error {
+	if err != ErrMaxDepth && errors.Is(err, ErrMaxDepth) {
+		return err
+	}
+	return fmt.Errorf(format+": %w", name, err)
+}
@@ -33,7 +33,7 @@ type data struct {
 	Custom custom
 }
 
-func (d *data) StringFunc(r binstruct.Reader) (string, error) {
+func (d *data) StringFuncDecode(r binstruct.Reader) (string, error) {
 	_, _, err := r.ReadBytes(1)
 	if err != nil {
 		return "", err
@@ -52,7 +52,7 @@ func (d *data) StringFunc(r binstruct.Reader) (string, error) {
 	return string(str), nil
 }
 
-func (d *data) MapFunc(r binstruct.Reader) error {
+func (d *data) MapFuncDecode(r binstruct.Reader) error {
 	s := make(map[int]string)
 
 	for i := 0; i < 2; i++ {
@@ -115,6 +115,7 @@ func Example_decodeCustom() {
 
 	spewCfg := spew.NewDefaultConfig()
 	spewCfg.SortKeys = true
+	spewCfg.DisableCapacities = true // capacities depend on how append grows slices
 	fmt.Print(spewCfg.Sdump(actual))
 
 	// Output: (binstruct_test.data) {
@@ -122,15 +123,15 @@ func Example_decodeCustom() {
 	//  Str: (string) (len=5) "hello",
 	//  Int: (int32) 10,
 	//  ArrLen: (uint16) 2,
-	//  ISlice: ([]int) (len=2 cap=2) {
+	//  ISlice: ([]int) (len=2) {
 	//   (int) 17,
 	//   (int) 34
 	//  },
-	//  IArr: ([2]int32) (len=2 cap=2) {
+	//  IArr: ([2]int32) (len=2) {
 	//   (int32) 51,
 	//   (int32) 68
 	//  },
-	//  SSlice: ([]string) (len=2 cap=2) {
+	//  SSlice: ([]string) (len=2) {
 	//   (string) (len=2) "hi",
 	//   (string) (len=3) "yay"
 	//  },
@@ -141,12 +142,12 @@ func Example_decodeCustom() {
 	//  Skip: ([]uint8) <nil>,
 	//  Custom: (binstruct_test.custom) {
 	//   ID: (int16) 255,
-	//   _: ([1]uint8) (len=1 cap=1) {
+	//   _: ([1]uint8) (len=1) {
 	//    00000000  00                                                |.|
 	//   },
 	//   TypeLen: (int16) 4,
 	//   Type: (string) (len=4) "test",
-	//   B: ([]uint8) (len=3 cap=4) {
+	//   B: ([]uint8) (len=3) {
 	//    00000000  68 69 21                                          |hi!|
 	//   }
 	//  }
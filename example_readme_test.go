@@ -127,3 +127,34 @@ func Example_readmeReader() {
 	// Read 4 bytes: []byte{0x7, 0x8, 0x9, 0xa}
 	// Read all: []byte{0xb, 0xc, 0xd, 0xe, 0xf}
 }
+
+func Example_readmeBitFields() {
+	type dataStruct struct {
+		Version uint8 `bin:"bits:4"`
+		IHL     uint8 `bin:"bits:4"`
+		TTL     uint8 // a regular field ends the group
+		Urgent  bool  `bin:"bits:1,lsb"` // starts a group packed from the least significant bit
+		Window  uint8 `bin:"bits:7"`
+	}
+
+	data := []byte{0x45, 0x40, 0x0b}
+
+	var actual dataStruct
+	err := binstruct.UnmarshalBE(data, &actual)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%+v\n", actual)
+
+	got, err := binstruct.MarshalBE(actual)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("% x", got)
+
+	// Output:
+	// {Version:4 IHL:5 TTL:64 Urgent:true Window:5}
+	// 45 40 0b
+}
@@ -3,14 +3,13 @@ package main
 import (
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"io"
 	"log"
 	"os"
 
 	"github.com/davecgh/go-spew/spew"
 
-	"github.com/ghostiam/binstruct"
+	"github.com/mainjzb/binstruct"
 )
 
 // Portable Network Graphics (PNG) Specification: https://www.w3.org/TR/PNG/
@@ -32,24 +31,9 @@ func main() {
 }
 
 type PNG struct {
-	Header [8]byte // Magic: 0x89 0x50 0x4E 0x47 0x0D 0x0A 0x1A 0x0A
+	Header [8]byte `bin:"magic:0x89504E470D0A1A0A"`
 	IHDR   IHDR
-	Chunks []Chunk `bin:"ReadChunks"`
-}
-
-func (png *PNG) ReadChunks(r binstruct.Reader) error {
-	for {
-		var c Chunk
-		err := r.Unmarshal(&c)
-		if errors.Is(err, io.EOF) {
-			return nil
-		}
-		if err != nil {
-			return fmt.Errorf("failed read png chunk: %w", err)
-		}
-
-		png.Chunks = append(png.Chunks, c)
-	}
+	Chunks []Chunk `bin:"len:*"`
 }
 
 // https://www.w3.org/TR/PNG/#11IHDR
@@ -92,7 +76,7 @@ type Chunk struct {
 	CRC  [4]byte
 }
 
-func (c *Chunk) ReadChunkData(r binstruct.Reader) (interface{}, error) {
+func (c *Chunk) ReadChunkDataDecode(r binstruct.Reader) (interface{}, error) {
 	switch c.Type {
 	case "PLTE": // https://www.w3.org/TR/PNG/#11PLTE
 		v := PaletteData{DataLen: c.Len}
@@ -173,7 +157,7 @@ type InternationalTextData struct {
 	Text              string `bin:"len:DataLen-2"` // DataLen - CompressionFlag - CompressionMethod
 }
 
-func (d *InternationalTextData) NullTerminatedString(r binstruct.Reader) (string, error) {
+func (d *InternationalTextData) NullTerminatedStringDecode(r binstruct.Reader) (string, error) {
 	var b []byte
 
 	var readCount int32
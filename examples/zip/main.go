@@ -1,17 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"encoding/binary"
-	"errors"
-	"fmt"
-	"io"
 	"log"
 	"os"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 
-	"github.com/ghostiam/binstruct"
+	"github.com/mainjzb/binstruct"
 )
 
 // .ZIP File Format Specification: https://pkware.cachefly.net/webdocs/casestudies/APPNOTE.TXT
@@ -33,74 +30,25 @@ func main() {
 }
 
 type ZIP struct {
-	_                       byte                        `bin:"ParseZIPSections"` // Call helper method for scan
-	LocalFileSections       []ZIPLocalFileSection       `bin:"-"`
-	CentralDirEntrySections []ZIPCentralDirEntrySection `bin:"-"`
-	EndOfCentralDirSection  ZIPEndOfCentralDirSection   `bin:"-"`
+	Sections []ZIPSection `bin:"len:*"`
 }
 
-func (zip *ZIP) ParseZIPSections(r binstruct.Reader) error {
-	for {
-		// Find magic PK (0x50 0x4B)
-		var magicPrevByte byte
-		for {
-			b, err := r.ReadByte()
-			if errors.Is(err, io.EOF) {
-				return nil
-			}
-			if err != nil {
-				return fmt.Errorf("failed read magic PK: %w", err)
-			}
-
-			if magicPrevByte == 'P' && b == 'K' {
-				magicPrevByte = 0x00
-				break // exit from loop
-			}
-
-			magicPrevByte = b
-		}
-
-		// read section type
-		_, sectionType, err := r.ReadBytes(2)
-		if err != nil {
-			return fmt.Errorf("failed read section type: %w", err)
-		}
-
-		switch {
-		case bytes.Equal(sectionType, []byte{0x03, 0x04}):
-			// parse ZIPLocalFileSection
-			var localFileSection ZIPLocalFileSection
-			err = r.Unmarshal(&localFileSection)
-			if err != nil {
-				return fmt.Errorf("failed Unmarshal ZIPLocalFileSection: %w", err)
-			}
-
-			zip.LocalFileSections = append(zip.LocalFileSections, localFileSection)
-
-		case bytes.Equal(sectionType, []byte{0x01, 0x02}):
-			// parse CentralDirEntry
-			var centralDirEntrySections ZIPCentralDirEntrySection
-			err = r.Unmarshal(&centralDirEntrySections)
-			if err != nil {
-				return fmt.Errorf("failed Unmarshal ZIPCentralDirEntrySection: %w", err)
-			}
-
-			zip.CentralDirEntrySections = append(zip.CentralDirEntrySections, centralDirEntrySections)
-
-		case bytes.Equal(sectionType, []byte{0x05, 0x06}):
-			// parse EndOfCentralDir
-			var endOfCentralDirSections ZIPEndOfCentralDirSection
-			err = r.Unmarshal(&endOfCentralDirSections)
-			if err != nil {
-				return fmt.Errorf("failed Unmarshal ZIPEndOfCentralDir: %w", err)
-			}
+type ZIPSection struct {
+	Signature [2]byte        // Magic: 'P' 'K'
+	Type      uint16         // 0x0403, 0x0201 or 0x0605
+	Body      ZIPSectionBody `bin:"switch:Type"`
+}
 
-			zip.EndOfCentralDirSection = endOfCentralDirSections
+// ZIPSectionBody is one of ZIPLocalFileSection, ZIPCentralDirEntrySection
+// or ZIPEndOfCentralDirSection, selected by ZIPSection.Type.
+type ZIPSectionBody interface{}
 
-		default:
-			log.Printf("unknown section type: %#x", sectionType)
-		}
-	}
+func init() {
+	binstruct.RegisterUnion[ZIPSectionBody](map[int64]ZIPSectionBody{
+		0x0403: ZIPLocalFileSection{},
+		0x0201: ZIPCentralDirEntrySection{},
+		0x0605: ZIPEndOfCentralDirSection{},
+	})
 }
 
 type ZIPLocalFileSection struct {
@@ -112,8 +60,7 @@ type LocalFileHeader struct {
 	Version           uint16
 	Flags             [2]byte
 	CompressionMethod uint16
-	FileModTime       uint16
-	FileModDate       uint16
+	FileModTime       time.Time `bin:"time:dos"` // MS-DOS time then date
 	Crc32             [4]byte
 	CompressedSize    uint32
 	UncompressedSize  uint32
@@ -128,8 +75,7 @@ type ZIPCentralDirEntrySection struct {
 	VersionNeededToExtract int16
 	Flags                  [2]byte
 	CompressionMethod      int16
-	LastModFileTime        int16
-	LastModFileDate        int16
+	LastModFileTime        time.Time `bin:"time:dos"` // MS-DOS time then date
 	Crc32                  [4]byte
 	CompressedSize         int32
 	UncompressedSize       int32
@@ -0,0 +1,472 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ExprSyntaxError describes a malformed expression in a tag value.
+// Column is the 1-based position of the offending character.
+type ExprSyntaxError struct {
+	Expr   string
+	Column int
+	Msg    string
+}
+
+func (e *ExprSyntaxError) Error() string {
+	return fmt.Sprintf("binstruct: expression %q: column %d: %s", e.Expr, e.Column, e.Msg)
+}
+
+var (
+	// ErrDivisionByZero is returned when an expression divides by zero
+	ErrDivisionByZero = errors.New("binstruct: division by zero")
+	// ErrNegativeShift is returned when an expression shifts by a negative count
+	ErrNegativeShift = errors.New("binstruct: negative shift count")
+)
+
+// Expressions are evaluated on int64 values. Comparison and logical
+// operators return 1 for true and 0 for false. Operator precedence
+// follows Go:
+//
+//	5  *  /  %  <<  >>  &
+//	4  +  -  |  ^
+//	3  ==  !=  <  <=  >  >=
+//	2  &&
+//	1  ||
+//
+// Unary operators are -, +, ! and ^ (bitwise not).
+
+// exprEnv holds the values that identifiers in an expression are
+// resolved against: the struct being processed and its parents,
+// outermost first.
+type exprEnv struct {
+	structValue        reflect.Value
+	parentStructValues []reflect.Value
+}
+
+type numberExpr int64
+
+func (e numberExpr) eval(exprEnv) (int64, error) {
+	return int64(e), nil
+}
+
+const (
+	exprSelf   = "_"
+	exprParent = "_parent"
+	exprRoot   = "_root"
+)
+
+// fieldExpr reads the value of an integer or boolean field. The path
+// may start with _ (the value itself), _parent (repeatable) or _root and
+// may descend into already decoded nested structs, e.g.
+// _root.Header.EntryCount.
+type fieldExpr []string
+
+func newFieldExpr(name string) fieldExpr {
+	return strings.Split(name, ".")
+}
+
+func (e fieldExpr) String() string {
+	return strings.Join(e, ".")
+}
+
+func (e fieldExpr) eval(env exprEnv) (int64, error) {
+	v := env.structValue
+	path := []string(e)
+
+	switch path[0] {
+	case exprSelf:
+		path = path[1:]
+
+	case exprRoot:
+		if len(env.parentStructValues) > 0 {
+			v = env.parentStructValues[0]
+		}
+		path = path[1:]
+
+	case exprParent:
+		depth := 0
+		for len(path) > 0 && path[0] == exprParent {
+			depth++
+			path = path[1:]
+		}
+
+		if depth > len(env.parentStructValues) {
+			return 0, errors.New("no parent struct for " + e.String())
+		}
+		v = env.parentStructValues[len(env.parentStructValues)-depth]
+	}
+
+	for _, name := range path {
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+
+		if v.Kind() != reflect.Struct {
+			return 0, errors.New("can't get field len from " + e.String() + " field")
+		}
+		v = v.FieldByName(name)
+	}
+
+	return fieldInt(v, e.String())
+}
+
+func fieldInt(v reflect.Value, name string) (int64, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, errors.New("can't get field len from " + name + " field")
+	}
+}
+
+// constValue returns the value of an expression that refers to no
+// fields, which is known before any data is read.
+func constValue(e expr) (int64, bool) {
+	if !isConstExpr(e) {
+		return 0, false
+	}
+
+	v, err := e.eval(exprEnv{})
+	return v, err == nil
+}
+
+func isConstExpr(e expr) bool {
+	switch e := e.(type) {
+	case numberExpr:
+		return true
+	case *unaryExpr:
+		return isConstExpr(e.x)
+	case *binaryExpr:
+		return isConstExpr(e.x) && isConstExpr(e.y)
+	default:
+		return false
+	}
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+func (e *unaryExpr) eval(env exprEnv) (int64, error) {
+	x, err := e.x.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch e.op {
+	case "-":
+		return -x, nil
+	case "!":
+		return boolInt(x == 0), nil
+	case "^":
+		return ^x, nil
+	default: // "+"
+		return x, nil
+	}
+}
+
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+func (e *binaryExpr) eval(env exprEnv) (int64, error) {
+	x, err := e.x.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	// Short-circuit logical operators
+	switch {
+	case e.op == "&&" && x == 0:
+		return 0, nil
+	case e.op == "||" && x != 0:
+		return 1, nil
+	}
+
+	y, err := e.y.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch e.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			return 0, ErrDivisionByZero
+		}
+		if e.op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "&":
+		return x & y, nil
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	case "<<", ">>":
+		if y < 0 {
+			return 0, ErrNegativeShift
+		}
+		if e.op == "<<" {
+			return x << uint64(y), nil
+		}
+		return x >> uint64(y), nil
+	case "==":
+		return boolInt(x == y), nil
+	case "!=":
+		return boolInt(x != y), nil
+	case "<":
+		return boolInt(x < y), nil
+	case "<=":
+		return boolInt(x <= y), nil
+	case ">":
+		return boolInt(x > y), nil
+	case ">=":
+		return boolInt(x >= y), nil
+	default: // "&&", "||"
+		return boolInt(y != 0), nil
+	}
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4, "|": 4, "^": 4,
+	"*": 5, "/": 5, "%": 5, "<<": 5, ">>": 5, "&": 5,
+}
+
+// Longest operators first, so that "<<" is not read as "<".
+var exprOperators = []string{
+	"<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+", "-", "*", "/", "%", "&", "|", "^", "<", ">", "!", "(", ")",
+}
+
+type exprTokenKind int
+
+const (
+	exprTokenEOF exprTokenKind = iota
+	exprTokenNumber
+	exprTokenIdent
+	exprTokenOperator
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	pos  int // byte offset in the source
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	cur    int
+}
+
+// parseExpr parses a tag value into an expression tree.
+func parseExpr(src string) (expr, error) {
+	p := &exprParser{src: src}
+	err := p.tokenize()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == exprTokenEOF {
+		return nil, p.errorf(p.peek(), "empty expression")
+	}
+
+	e, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != exprTokenEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+
+	return e, nil
+}
+
+func (p *exprParser) tokenize() error {
+	i := 0
+	for i < len(p.src) {
+		c := p.src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+
+		case isDigit(c):
+			start := i
+			for i < len(p.src) && isIdentChar(p.src[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: exprTokenNumber, text: p.src[start:i], pos: start})
+
+		case isIdentChar(c):
+			start := i
+			for i < len(p.src) && (isIdentChar(p.src[i]) || p.src[i] == '.') {
+				i++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: exprTokenIdent, text: p.src[start:i], pos: start})
+
+		default:
+			var op string
+			for _, o := range exprOperators {
+				if strings.HasPrefix(p.src[i:], o) {
+					op = o
+					break
+				}
+			}
+
+			if op == "" {
+				return &ExprSyntaxError{Expr: p.src, Column: i + 1, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+
+			p.tokens = append(p.tokens, exprToken{kind: exprTokenOperator, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	p.tokens = append(p.tokens, exprToken{kind: exprTokenEOF, pos: len(p.src)})
+	return nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.cur]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.cur]
+	if t.kind != exprTokenEOF {
+		p.cur++
+	}
+	return t
+}
+
+func (p *exprParser) errorf(t exprToken, format string, args ...interface{}) error {
+	return &ExprSyntaxError{Expr: p.src, Column: t.pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseBinary parses operators with precedence of at least minPrec.
+func (p *exprParser) parseBinary(minPrec int) (expr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec, ok := binaryPrecedence[t.text]
+		if t.kind != exprTokenOperator || !ok || prec < minPrec {
+			return x, nil
+		}
+		p.next()
+
+		y, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		x = &binaryExpr{op: t.text, x: x, y: y}
+	}
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	t := p.peek()
+	if t.kind == exprTokenOperator {
+		switch t.text {
+		case "-", "+", "!", "^":
+			p.next()
+			x, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+
+			// Fold negative literals, so "-10" is a plain number
+			if n, ok := x.(numberExpr); ok && t.text == "-" {
+				return -n, nil
+			}
+
+			return &unaryExpr{op: t.text, x: x}, nil
+		}
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case exprTokenNumber:
+		n, err := strconv.ParseInt(t.text, 0, 64)
+		if err != nil {
+			// Allow unsigned 64-bit constants like 0xFFFFFFFFFFFFFFFF
+			u, uerr := strconv.ParseUint(t.text, 0, 64)
+			if uerr != nil {
+				return nil, p.errorf(t, "invalid number %q", t.text)
+			}
+			n = int64(u)
+		}
+		return numberExpr(n), nil
+
+	case exprTokenIdent:
+		f := newFieldExpr(t.text)
+		for _, name := range f {
+			if name == "" {
+				return nil, p.errorf(t, "invalid field path %q", t.text)
+			}
+		}
+		return f, nil
+
+	case exprTokenOperator:
+		if t.text == "(" {
+			x, err := p.parseBinary(1)
+			if err != nil {
+				return nil, err
+			}
+
+			if c := p.next(); c.text != ")" {
+				return nil, p.errorf(c, "missing closing parenthesis")
+			}
+			return x, nil
+		}
+		return nil, p.errorf(t, "unexpected %q", t.text)
+
+	default: // exprTokenEOF
+		return nil, p.errorf(t, "unexpected end of expression")
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
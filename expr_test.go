@@ -0,0 +1,177 @@
+package binstruct
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseExpr(t *testing.T) {
+	structValue := reflect.ValueOf(struct {
+		HeaderLen uint8
+		Flags     uint16
+		Neg       int32
+		Enabled   bool
+	}{
+		HeaderLen: 0x45,
+		Flags:     0x0c,
+		Neg:       -3,
+		Enabled:   true,
+	})
+
+	tests := []struct {
+		expr string
+		want int64
+	}{
+		{expr: "42", want: 42},
+		{expr: "2+2*2", want: 6},
+		{expr: "(2+2)*2", want: 8},
+		{expr: "10 - 4 - 3", want: 3},
+		{expr: "17 % 5", want: 2},
+		{expr: "0x10", want: 16},
+		{expr: "0X1f", want: 31},
+		{expr: "0o17", want: 15},
+		{expr: "017", want: 15},
+		{expr: "0b101", want: 5},
+		{expr: "1_000", want: 1000},
+		{expr: "-2", want: -2},
+		{expr: "-(2+3)", want: -5},
+		{expr: "- -2", want: 2},
+		{expr: "^0", want: -1},
+		{expr: "1 << 4 | 1", want: 17},
+		{expr: "0xF0 >> 4", want: 15},
+		{expr: "6 ^ 3", want: 5},
+		{expr: "(HeaderLen & 0x0F) * 4", want: 20},
+		{expr: "Flags & 0x04 != 0", want: 1},
+		{expr: "Flags & 0x01 != 0", want: 0},
+		{expr: "Neg * 2", want: -6},
+		{expr: "Enabled", want: 1},
+		{expr: "!Enabled", want: 0},
+		{expr: "HeaderLen >= 0x45 && Flags < 16", want: 1},
+		{expr: "HeaderLen == 0 || Flags == 0x0c", want: 1},
+		{expr: "1 <= 0", want: 0},
+		{expr: "0 || 1/0", want: 0},
+		{expr: "0xFFFFFFFFFFFFFFFF", want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := parseExpr(tt.expr)
+			require.NoError(t, err)
+
+			got, err := e.eval(exprEnv{structValue: structValue})
+			if tt.expr == "0 || 1/0" {
+				require.True(t, errors.Is(err, ErrDivisionByZero))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_parseExprError(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: "", wantErr: `binstruct: expression "": column 1: empty expression`},
+		{expr: "1 +", wantErr: `binstruct: expression "1 +": column 4: unexpected end of expression`},
+		{expr: "(1 + 2", wantErr: `binstruct: expression "(1 + 2": column 7: missing closing parenthesis`},
+		{expr: "1 + 2)", wantErr: `binstruct: expression "1 + 2)": column 6: unexpected ")"`},
+		{expr: "A $ B", wantErr: `binstruct: expression "A $ B": column 3: unexpected character '$'`},
+		{expr: "0x1G", wantErr: `binstruct: expression "0x1G": column 1: invalid number "0x1G"`},
+		{expr: "2 * * 3", wantErr: `binstruct: expression "2 * * 3": column 5: unexpected "*"`},
+		{expr: "A B", wantErr: `binstruct: expression "A B": column 3: unexpected "B"`},
+		{expr: "1 + A..B", wantErr: `binstruct: expression "1 + A..B": column 5: invalid field path "A..B"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseExpr(tt.expr)
+			require.EqualError(t, err, tt.wantErr)
+
+			var syntaxErr *ExprSyntaxError
+			require.True(t, errors.As(err, &syntaxErr))
+		})
+	}
+}
+
+func Test_ExprRuntimeError(t *testing.T) {
+	type dataStruct struct {
+		Shift int8
+		Data  []byte `bin:"len:1 << Shift"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0xff}, &actual)
+	require.True(t, errors.Is(err, ErrNegativeShift))
+}
+
+func Test_ExprPrecedenceInTag(t *testing.T) {
+	data := []byte{0x45, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14}
+
+	type dataStruct struct {
+		HeaderLen uint8
+		Options   []byte `bin:"len:(HeaderLen & 0x0F) * 4 - 1"`
+		Last      byte   `bin:"offsetEnd:-0x01"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Len(t, actual.Options, 19)
+	require.Equal(t, byte(0x14), actual.Last)
+}
+
+func Test_ExprParentAndRootFields(t *testing.T) {
+	type entry struct {
+		NameLen uint8
+		Name    string `bin:"len:NameLen"`
+	}
+
+	type body struct {
+		Names  []entry `bin:"len:_root.Header.EntryCount"`
+		Values []byte  `bin:"len:_parent.ValueLen"`
+		Extra  struct {
+			Data []byte `bin:"len:_parent._parent.Header.ExtraLen"`
+		}
+	}
+
+	type dataStruct struct {
+		Header struct {
+			EntryCount uint8
+			ExtraLen   uint8
+		}
+		ValueLen uint16
+		Body     body
+		Tail     []byte `bin:"len:Header.ExtraLen + 1"`
+	}
+
+	data := []byte{
+		0x02, 0x01, // Header
+		0x00, 0x03, // ValueLen
+		0x02, 'h', 'i', 0x03, 'y', 'a', 'y', // Names
+		0x0a, 0x0b, 0x0c, // Values
+		0xee,       // Extra.Data
+		0x01, 0x02, // Tail
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, []entry{{NameLen: 2, Name: "hi"}, {NameLen: 3, Name: "yay"}}, actual.Body.Names)
+	require.Equal(t, []byte{0x0a, 0x0b, 0x0c}, actual.Body.Values)
+	require.Equal(t, []byte{0xee}, actual.Body.Extra.Data)
+	require.Equal(t, []byte{0x01, 0x02}, actual.Tail)
+}
+
+func Test_ExprParentMissing(t *testing.T) {
+	type dataStruct struct {
+		Data []byte `bin:"len:_parent.Count"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x01}, &actual)
+	require.EqualError(t, err, `failed set value to field "Data": eval len: no parent struct for _parent.Count`)
+}
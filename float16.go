@@ -0,0 +1,142 @@
+package binstruct
+
+import (
+	"errors"
+	"math"
+	"reflect"
+)
+
+// float16ToFloat32 converts IEEE 754 half precision bits to a float32.
+// Every half precision value, subnormals included, is exact in a float32.
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1F
+	mant := uint32(h & 0x3FF)
+
+	switch exp {
+	case 0: // zero or subnormal
+		f := float32(math.Ldexp(float64(mant), -24))
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1F: // infinity or NaN
+		return math.Float32frombits(sign | 0x7F800000 | mant<<13)
+	default:
+		return math.Float32frombits(sign | (exp-15+127)<<23 | mant<<13)
+	}
+}
+
+// float32ToFloat16 converts a float32 to IEEE 754 half precision bits,
+// rounding to nearest even. Values too large become infinity and NaN
+// stays NaN.
+func float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xFF
+	mant := bits & 0x7FFFFF
+
+	if exp == 0xFF {
+		if mant != 0 {
+			return sign | 0x7E00 | uint16(mant>>13)
+		}
+		return sign | 0x7C00
+	}
+
+	e := exp - 127 + 15
+	if e >= 0x1F {
+		return sign | 0x7C00
+	}
+
+	if e <= 0 {
+		// Subnormal, the implicit leading bit becomes explicit
+		shift := uint(14 - e)
+		if shift > 24 {
+			return sign
+		}
+
+		m := mant | 0x800000
+		h := m >> shift
+		rem := m & (1<<shift - 1)
+		half := uint32(1) << (shift - 1)
+		if rem > half || (rem == half && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+
+	// A carry out of the mantissa correctly increments the exponent
+	h := uint32(e)<<10 | mant>>13
+	rem := mant & 0x1FFF
+	if rem > 0x1000 || (rem == 0x1000 && h&1 == 1) {
+		h++
+	}
+	return sign | uint16(h)
+}
+
+// bfloat16ToFloat32 converts bfloat16 bits, the high half of a float32.
+func bfloat16ToFloat32(b uint16) float32 {
+	return math.Float32frombits(uint32(b) << 16)
+}
+
+// float32ToBFloat16 converts a float32 to bfloat16 bits, rounding to
+// nearest even.
+func float32ToBFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	if math.IsNaN(float64(f)) {
+		// Keep a NaN a NaN when its payload is in the dropped bits
+		return uint16(bits>>16) | 0x40
+	}
+
+	bits += 0x7FFF + (bits>>16)&1
+	return uint16(bits >> 16)
+}
+
+const (
+	float16Half   = "f16"
+	float16BFloat = "bf16"
+)
+
+func checkFloat16Kind(fieldValue reflect.Value) error {
+	switch fieldValue.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return nil
+	default:
+		return errors.New(`f16 and bf16 are not supported for type "` + fieldValue.Kind().String() + `"`)
+	}
+}
+
+func readFloat16(r Reader, fieldValue reflect.Value, fieldData *fieldReadData) error {
+	err := checkFloat16Kind(fieldValue)
+	if err != nil {
+		return err
+	}
+
+	var f float32
+	if fieldData.Float16 == float16BFloat {
+		f, err = r.ReadBFloat16()
+	} else {
+		f, err = r.ReadFloat16()
+	}
+	if err != nil {
+		return err
+	}
+
+	if fieldValue.CanSet() {
+		fieldValue.SetFloat(float64(f))
+	}
+	return nil
+}
+
+func writeFloat16(w Writer, fieldValue reflect.Value, fieldData *fieldReadData) error {
+	err := checkFloat16Kind(fieldValue)
+	if err != nil {
+		return err
+	}
+
+	f := float32(fieldValue.Float())
+	if fieldData.Float16 == float16BFloat {
+		return w.WriteBFloat16(f)
+	}
+	return w.WriteFloat16(f)
+}
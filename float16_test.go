@@ -0,0 +1,96 @@
+package binstruct
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Float16RoundTrip(t *testing.T) {
+	for i := 0; i <= math.MaxUint16; i++ {
+		h := uint16(i)
+		f := float16ToFloat32(h)
+		if math.IsNaN(float64(f)) {
+			require.True(t, math.IsNaN(float64(float16ToFloat32(float32ToFloat16(f)))), "%#04x", h)
+			continue
+		}
+		require.Equal(t, h, float32ToFloat16(f), "%#04x", h)
+	}
+}
+
+func Test_Float16Values(t *testing.T) {
+	tests := []struct {
+		h uint16
+		f float32
+	}{
+		{0x0000, 0},
+		{0x3C00, 1},
+		{0xC000, -2},
+		{0x7BFF, 65504},
+		{0x0001, float32(math.Ldexp(1, -24))}, // smallest subnormal
+		{0x03FF, float32(math.Ldexp(1023, -24))},
+		{0x0400, float32(math.Ldexp(1, -14))}, // smallest normal
+		{0x7C00, float32(math.Inf(1))},
+		{0xFC00, float32(math.Inf(-1))},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.f, float16ToFloat32(tt.h))
+		require.Equal(t, tt.h, float32ToFloat16(tt.f))
+	}
+
+	require.Equal(t, uint16(0x8000), float32ToFloat16(float32(math.Copysign(0, -1))))
+	require.Equal(t, uint16(0x7C00), float32ToFloat16(65520))                         // rounds up to infinity
+	require.Equal(t, uint16(0x7BFF), float32ToFloat16(65519))                         // rounds down
+	require.Equal(t, uint16(0x3C00), float32ToFloat16(1+float32(math.Ldexp(1, -11)))) // tie to even
+	require.Equal(t, uint16(0x3C02), float32ToFloat16(1+float32(math.Ldexp(3, -11)))) // tie to even
+	require.Equal(t, uint16(0x0000), float32ToFloat16(float32(math.Ldexp(1, -25))))   // tie to zero
+	require.Equal(t, uint16(0x0001), float32ToFloat16(float32(math.Ldexp(1.5, -25))))
+	require.True(t, math.IsNaN(float64(float16ToFloat32(float32ToFloat16(float32(math.NaN()))))))
+}
+
+func Test_BFloat16Values(t *testing.T) {
+	require.Equal(t, uint16(0x3F80), float32ToBFloat16(1))
+	require.Equal(t, float32(1), bfloat16ToFloat32(0x3F80))
+	require.Equal(t, uint16(0xC049), float32ToBFloat16(-3.14159))
+	require.Equal(t, uint16(0x7F80), float32ToBFloat16(float32(math.Inf(1))))
+	require.Equal(t, uint16(0x7F80), float32ToBFloat16(math.MaxFloat32))                  // rounds to infinity
+	require.Equal(t, uint16(0x0001), float32ToBFloat16(math.Float32frombits(0x00010000))) // subnormal
+
+	// A NaN with its payload in the low bits stays a NaN
+	nan := math.Float32frombits(0x7F800001)
+	require.True(t, math.IsNaN(float64(bfloat16ToFloat32(float32ToBFloat16(nan)))))
+}
+
+func Test_Float16Tag(t *testing.T) {
+	type dataStruct struct {
+		Half   float32   `bin:"f16"`
+		Brain  float32   `bin:"bf16"`
+		Wide   float64   `bin:"f16,le"`
+		Values []float32 `bin:"len:2,[f16]"`
+	}
+
+	data := []byte{
+		0x3C, 0x00,
+		0xC0, 0x49,
+		0x00, 0xC0,
+		0x7C, 0x00, 0x00, 0x01,
+	}
+
+	want := dataStruct{
+		Half:   1,
+		Brain:  -3.140625,
+		Wide:   -2,
+		Values: []float32{float32(math.Inf(1)), float32(math.Ldexp(1, -24))},
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
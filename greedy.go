@@ -0,0 +1,55 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// atEOF reports whether there is nothing left to read.
+func atEOF(r Reader) (bool, error) {
+	_, err := r.Peek(1)
+	if errors.Is(err, io.EOF) {
+		return true, nil
+	}
+	return false, err
+}
+
+// readGreedy decodes slice elements until the input ends. The input must
+// end on an element boundary, a partial element is io.ErrUnexpectedEOF.
+func (u *unmarshal) readGreedy(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
+	for i := 0; ; i++ {
+		eof, err := atEOF(u.r)
+		if err != nil || eof {
+			return err
+		}
+
+		start, err := u.r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		tmpV := reflect.New(fieldValue.Type().Elem()).Elem()
+		err = u.setValueToField(structValue, tmpV, fieldData.ElemFieldData, parentStructValues)
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("partial element %d: %w", i, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return err
+		}
+
+		end, err := u.r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		if end == start {
+			return fmt.Errorf("element %d consumed no bytes, greedy slice would never end", i)
+		}
+
+		if fieldValue.CanSet() {
+			fieldValue.Set(reflect.Append(fieldValue, tmpV))
+		}
+	}
+}
@@ -46,17 +46,22 @@ func InnerFunctionHandler(w Writer, structValue, fieldValue reflect.Value, field
 }
 
 func LengthHandler(w Writer, structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
-	sum, err := calcLength(structValue.Interface(), append(parentStructValues))
+	// The struct is the one being marshaled, its nesting is counted
+	sum, err := newMarshal(w).fieldsLength(structValue, parentStructValues)
 	if err != nil {
 		return err
 	}
-	if fieldData.Length != nil {
-		// value, err = r.ReadIntX(int(*fieldData.Length))
+	length, err := fieldData.evalLength(exprEnv{structValue, parentStructValues})
+	if err != nil {
+		return err
+	}
+	if length != nil {
+		// value, err = r.ReadIntX(int(*length))
 		switch fieldValue.Kind() {
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			err = w.WriteIntX(int64(sum), int(*fieldData.Length))
+			err = w.WriteIntX(int64(sum), int(*length))
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			err = w.WriteUintX(uint64(sum), int(*fieldData.Length))
+			err = w.WriteUintX(uint64(sum), int(*length))
 		}
 	} else {
 
@@ -86,16 +91,21 @@ func LengthHandler(w Writer, structValue, fieldValue reflect.Value, fieldData *f
 }
 
 func LengthWithoutSelfHandler(w Writer, structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
-	sum, err := calcLength(structValue.Interface(), append(parentStructValues))
+	// The struct is the one being marshaled, its nesting is counted
+	sum, err := newMarshal(w).fieldsLength(structValue, parentStructValues)
+	if err != nil {
+		return err
+	}
+	length, err := fieldData.evalLength(exprEnv{structValue, parentStructValues})
 	if err != nil {
 		return err
 	}
-	if fieldData.Length != nil {
+	if length != nil {
 		switch fieldValue.Kind() {
 		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			err = w.WriteIntX(int64(sum-int(*fieldData.Length)), int(*fieldData.Length))
+			err = w.WriteIntX(int64(sum-int(*length)), int(*length))
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			err = w.WriteUintX(uint64(sum-int(*fieldData.Length)), int(*fieldData.Length))
+			err = w.WriteUintX(uint64(sum-int(*length)), int(*length))
 		}
 	} else {
 
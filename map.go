@@ -0,0 +1,142 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// readMap decodes length entries of a map, each one a key followed by its
+// value. A key that occurs twice is an error.
+func (u *unmarshal) readMap(structValue, fieldValue reflect.Value, fieldData *fieldReadData, length int64, parentStructValues []reflect.Value) error {
+	// The count comes from the input, the map grows as entries decode
+	m := fieldValue
+	if m.IsNil() {
+		m = reflect.MakeMap(fieldValue.Type())
+	}
+
+	for i := int64(0); i < length; i++ {
+		key := reflect.New(fieldValue.Type().Key()).Elem()
+		err := u.setValueToField(structValue, key, fieldData.KeyFieldData, parentStructValues)
+		if err != nil {
+			return wrapError(err, "key %d", i)
+		}
+
+		value := reflect.New(fieldValue.Type().Elem()).Elem()
+		err = u.setValueToField(structValue, value, fieldData.ValFieldData, parentStructValues)
+		if err != nil {
+			return wrapError(err, "value of key %v", key)
+		}
+
+		if m.MapIndex(key).IsValid() {
+			return fmt.Errorf("duplicate key %v", key)
+		}
+		m.SetMapIndex(key, value)
+	}
+
+	if fieldValue.CanSet() {
+		fieldValue.Set(m)
+	}
+	return nil
+}
+
+// writeMap encodes the entries of a map in sorted key order, so the same
+// map always encodes to the same bytes.
+func (m *marshal) writeMap(structValue, fieldValue reflect.Value, fieldData *fieldReadData, length *int64, parentStructValues []reflect.Value) error {
+	if length == nil {
+		return errors.New("need set tag with len or prefix for map")
+	}
+
+	if *length != int64(fieldValue.Len()) {
+		return fmt.Errorf("map has %d entries, len is %d", fieldValue.Len(), *length)
+	}
+
+	for _, key := range sortedMapKeys(fieldValue) {
+		err := m.setValueToField(structValue, key, fieldData.KeyFieldData, parentStructValues)
+		if err != nil {
+			return wrapError(err, "key %v", key)
+		}
+
+		err = m.setValueToField(structValue, fieldValue.MapIndex(key), fieldData.ValFieldData, parentStructValues)
+		if err != nil {
+			return wrapError(err, "value of key %v", key)
+		}
+	}
+
+	return nil
+}
+
+// mapLength returns the number of bytes writeMap writes.
+func (m *marshal) mapLength(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) (int, error) {
+	var n int
+	iter := fieldValue.MapRange()
+	for iter.Next() {
+		keySize, err := m.getValueLength(structValue, iter.Key(), fieldData.KeyFieldData, parentStructValues)
+		if err != nil {
+			return 0, err
+		}
+
+		valueSize, err := m.getValueLength(structValue, iter.Value(), fieldData.ValFieldData, parentStructValues)
+		if err != nil {
+			return 0, err
+		}
+
+		n += keySize + valueSize
+	}
+	return n, nil
+}
+
+func sortedMapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return compareValues(keys[i], keys[j]) < 0
+	})
+	return keys
+}
+
+// compareValues orders map keys: numbers, strings and bools by value,
+// arrays and structs element by element. Other keys are ordered by their
+// printed form.
+func compareValues(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float() < b.Float(), a.Float() > b.Float())
+	case reflect.String:
+		return compareOrdered(a.String() < b.String(), a.String() > b.String())
+	case reflect.Bool:
+		return compareOrdered(!a.Bool() && b.Bool(), a.Bool() && !b.Bool())
+	case reflect.Array:
+		for i := 0; i < a.Len(); i++ {
+			if c := compareValues(a.Index(i), b.Index(i)); c != 0 {
+				return c
+			}
+		}
+		return 0
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if c := compareValues(a.Field(i), b.Field(i)); c != 0 {
+				return c
+			}
+		}
+		return 0
+	default:
+		sa, sb := fmt.Sprint(a), fmt.Sprint(b)
+		return compareOrdered(sa < sb, sa > sb)
+	}
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	default:
+		return 0
+	}
+}
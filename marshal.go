@@ -8,7 +8,18 @@ import (
 )
 
 type marshal struct {
-	w Writer
+	w    Writer
+	base int // offset of the current size section in the output
+	nest *nesting
+}
+
+// newMarshal returns a marshal for a handler that is given only the
+// Writer, it continues the nesting of the writer.
+func newMarshal(w Writer) *marshal {
+	if ww, ok := w.(*writer); ok {
+		return &marshal{w: w, nest: ww.nest}
+	}
+	return &marshal{w: w, nest: &nesting{max: DefaultMaxDepth}}
 }
 
 func (m *marshal) Marshal(v any) ([]byte, error) {
@@ -21,27 +32,68 @@ func (m *marshal) marshal(v any, parentStructValues []reflect.Value) ([]byte, er
 		return nil, &InvalidUnmarshalError{reflect.TypeOf(v)}
 	}
 
-	fieldCount := rv.NumField()
-	valueType := rv.Type()
+	err := m.marshalStruct(rv, parentStructValues)
+	if err != nil {
+		return nil, err
+	}
+
+	// Custom methods may leave bits of a partial byte behind
+	err = m.w.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return m.w.Bytes(), nil
+}
 
-	for i := 0; i < fieldCount; i++ {
-		fieldType := valueType.Field(i)
-		tags, err := parseTag(fieldType.Tag.Get(tagName))
+func (m *marshal) marshalStruct(structValue reflect.Value, parentStructValues []reflect.Value) error {
+	err := m.nest.enter()
+	if err != nil {
+		return err
+	}
+	defer m.nest.leave()
+
+	plan, err := getStructPlan(structValue.Type())
+	if err != nil {
+		return err
+	}
+
+	if plan.hasSizeOf {
+		structValue, err = m.fillSizeOf(plan, structValue, parentStructValues)
 		if err != nil {
-			return nil, fmt.Errorf(`failed parseTag for field "%s": %w`, fieldType.Name, err)
+			return err
 		}
+	}
 
-		fieldData, err := parseReadDataFromTags(rv, tags)
+	var structStart int64
+	if plan.hasPadding {
+		structStart, err = m.position()
 		if err != nil {
-			return nil, fmt.Errorf(`failed parse ReadData from tags for field "%s": %w`, fieldType.Name, err)
+			return err
+		}
+	}
+
+	for i := 0; i < len(plan.fields); i++ {
+		f := plan.fields[i]
+		if g := f.bitGroup; g != nil {
+			err = m.writeBitGroup(plan, g, structValue)
+			if err != nil {
+				return err
+			}
+
+			i += len(g.fields) - 1
+			continue
+		}
+
+		if f.data.hasPadding() {
+			err = m.writePaddedField(structStart, structValue, f, parentStructValues)
+		} else {
+			err = m.setValueToField(structValue, structValue.Field(f.index), f.data, parentStructValues)
 		}
-		fieldValue := rv.Field(i)
-		err = m.setValueToField(rv, fieldValue, fieldData, parentStructValues)
 		if err != nil {
-			return nil, fmt.Errorf(`failed set value to field "%s": %w`, fieldType.Name, err)
+			return fieldError(err, `failed set value to field "%s"`, f.name)
 		}
 	}
-	return m.w.Bytes(), nil
+	return nil
 }
 
 func (m *marshal) setValueToField(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
@@ -53,26 +105,45 @@ func (m *marshal) setValueToField(structValue, fieldValue reflect.Value, fieldDa
 		return nil
 	}
 
+	env := exprEnv{structValue, parentStructValues}
+	skip, err := fieldData.skip(env)
+	if err != nil || skip {
+		return err
+	}
+
+	if fieldValue.Kind() == reflect.Ptr && fieldValue.Type() != bigIntType {
+		return m.writePointer(structValue, fieldValue, fieldData, parentStructValues)
+	}
+
 	w := m.w
 	if fieldData.Order != nil {
 		w = w.WithOrder(fieldData.Order)
 	}
 
-	var err error
-	// err := setOffset(r, fieldData)
-	if err != nil {
-		return fmt.Errorf("set offset: %w", err)
+	if fieldData.Size != nil {
+		return m.writeSized(w, env, structValue, fieldValue, fieldData, parentStructValues)
+	}
+
+	// The constant is written regardless of the field value
+	if fieldData.Magic != nil {
+		_, err = w.Write(fieldData.Magic)
+		return err
 	}
 
 	if IsInnerFunction(fieldData.FuncName) {
 		return InnerFunctionHandler(w, structValue, fieldValue, fieldData, parentStructValues)
 	}
 
+	length, err := fieldData.evalLength(env)
+	if err != nil {
+		return fmt.Errorf("eval len: %w", err)
+	}
+
 	if fieldData.FuncName != "" {
 		var okCallFunc bool
 		okCallFunc, err = callEncodeFunc(w, fieldData.FuncName, structValue, fieldValue)
 		if err != nil {
-			return fmt.Errorf("call custom func(%s): %w", structValue.Type().Name(), err)
+			return wrapError(err, "call custom func(%s)", structValue.Type().Name())
 		}
 
 		if !okCallFunc {
@@ -81,7 +152,7 @@ func (m *marshal) setValueToField(structValue, fieldValue reflect.Value, fieldDa
 				sv := parentStructValues[i]
 				okCallFunc, err = callEncodeFunc(w, fieldData.FuncName, sv, fieldValue)
 				if err != nil {
-					return fmt.Errorf("call custom func from parent(%s): %w", sv.Type().Name(), err)
+					return wrapError(err, "call custom func from parent(%s)", sv.Type().Name())
 				}
 
 				if okCallFunc {
@@ -106,14 +177,54 @@ func (m *marshal) setValueToField(structValue, fieldValue reflect.Value, fieldDa
 		return nil
 	}
 
+	if fieldData.Until != nil && fieldValue.Kind() == reflect.Slice {
+		return m.writeUntil(structValue, fieldValue, fieldData, parentStructValues)
+	}
+
+	if fieldData.Greedy && (fieldValue.Kind() == reflect.String || fieldValue.Kind() == reflect.Slice) {
+		n := int64(fieldValue.Len())
+		length = &n
+	}
+
+	if fieldData.Prefix != "" {
+		length, err = writePrefix(w, fieldValue, fieldData)
+		if err != nil {
+			return err
+		}
+	}
+
+	if fieldData.Varint {
+		return writeVarint(w, fieldValue, fieldData)
+	}
+
+	if fieldData.BCD {
+		return writeBCD(w, fieldValue, fieldData, length)
+	}
+
+	if fieldData.Time != "" {
+		return writeTime(w, fieldValue, fieldData, length)
+	}
+
+	if isBigIntType(fieldValue.Type()) {
+		return writeBigInt(w, fieldValue, fieldData, length)
+	}
+
+	if fieldData.Float16 != "" {
+		return writeFloat16(w, fieldValue, fieldData)
+	}
+
+	if fieldData.scaled() {
+		return writeScaled(w, fieldValue, fieldData, length)
+	}
+
 	switch fieldValue.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		var value int64
 		var err error
 
-		if fieldData.Length != nil {
-			// value, err = r.ReadIntX(int(*fieldData.Length))
-			err = w.WriteIntX(fieldValue.Int(), int(*fieldData.Length))
+		if length != nil {
+			// value, err = r.ReadIntX(int(*length))
+			err = w.WriteIntX(fieldValue.Int(), int(*length))
 		} else {
 			switch fieldValue.Kind() {
 			case reflect.Int8:
@@ -144,9 +255,9 @@ func (m *marshal) setValueToField(structValue, fieldValue reflect.Value, fieldDa
 		// var value uint64
 		var err error
 
-		if fieldData.Length != nil {
-			// value, err = r.ReadUintX(int(*fieldData.Length))
-			err = w.WriteUintX(fieldValue.Uint(), int(*fieldData.Length))
+		if length != nil {
+			// value, err = r.ReadUintX(int(*length))
+			err = w.WriteUintX(fieldValue.Uint(), int(*length))
 		} else {
 			switch fieldValue.Kind() {
 			case reflect.Uint8:
@@ -184,22 +295,53 @@ func (m *marshal) setValueToField(structValue, fieldValue reflect.Value, fieldDa
 			return err
 		}
 	case reflect.Bool:
-		panic("don't func writeBool")
-		// b, err := r.ReadBool()
-		// if err != nil {
-		// 	return err
-		// }
+		var b byte
+		if fieldValue.Bool() {
+			b = 1
+		}
+
+		err = w.WriteByte(b)
+		if err != nil {
+			return err
+		}
 	case reflect.String:
-		if fieldData.Length == nil {
+		enc, err := getTextEncoding(fieldData.Encoding)
+		if err != nil {
+			return err
+		}
+
+		b, err := enc.encodeString(fieldValue.String())
+		if err != nil {
+			return err
+		}
+
+		if fieldData.Terminator != nil {
+			return writeTerminated(w, env, fieldData, b, enc.unitSize())
+		}
+
+		if length == nil {
 			return errors.New("need set tag with len for string")
 		}
-		_, err := w.Write([]byte(fieldValue.String()))
+
+		// Prefixed and greedy strings are as long as the value
+		if fieldData.Prefix == "" && !fieldData.Greedy {
+			b, err = fixedString(fieldValue.String(), *length, fieldData, enc)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = w.Write(b)
 		if err != nil {
 			return err
 		}
 	case reflect.Slice:
-		if fieldData.Length != nil {
-			for i := int64(0); i < *fieldData.Length; i++ {
+		if fieldData.Terminator != nil && fieldValue.Type().Elem().Kind() == reflect.Uint8 {
+			return writeTerminated(w, env, fieldData, fieldValue.Bytes(), 1)
+		}
+
+		if length != nil {
+			for i := int64(0); i < *length; i++ {
 				err = m.setValueToField(structValue, fieldValue.Index(int(i)), fieldData.ElemFieldData, parentStructValues)
 				if err != nil {
 					return err
@@ -215,8 +357,8 @@ func (m *marshal) setValueToField(structValue, fieldValue reflect.Value, fieldDa
 	case reflect.Array:
 		var arrLen int64
 
-		if fieldData.Length != nil {
-			arrLen = *fieldData.Length
+		if length != nil {
+			arrLen = *length
 		}
 
 		if arrLen == 0 {
@@ -229,10 +371,31 @@ func (m *marshal) setValueToField(structValue, fieldValue reflect.Value, fieldDa
 				return err
 			}
 		}
+	case reflect.Map:
+		return m.writeMap(structValue, fieldValue, fieldData, length, parentStructValues)
 	case reflect.Struct:
-		_, err := m.marshal(fieldValue.Interface(), append(parentStructValues, structValue))
+		err := m.marshalStruct(fieldValue, append(parentStructValues, structValue))
 		if err != nil {
-			return fmt.Errorf("unmarshal struct: %w", err)
+			return wrapError(err, "unmarshal struct")
+		}
+	case reflect.Interface:
+		variant, err := unionVariant(fieldValue.Type(), env, fieldData)
+		if err != nil {
+			return err
+		}
+
+		if fieldValue.IsNil() || fieldValue.Elem().Type() != variant {
+			return fmt.Errorf("union value of type %s does not match variant %s", unionValueType(fieldValue), variant)
+		}
+
+		value := fieldValue.Elem()
+		if value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
+
+		err = m.setValueToField(structValue, value, nil, parentStructValues)
+		if err != nil {
+			return wrapError(err, "marshal %s", variant)
 		}
 	default:
 		return errors.New(`type "` + fieldValue.Kind().String() + `" not supported`)
@@ -242,12 +405,17 @@ func (m *marshal) setValueToField(structValue, fieldValue reflect.Value, fieldDa
 }
 
 func callEncodeFunc(r Writer, funcName string, structValue, fieldValue reflect.Value) (bool, error) {
+	plan, err := getStructPlan(structValue.Type())
+	if err != nil {
+		return false, err
+	}
+
 	// Call methods
-	m := structValue.MethodByName(funcName + "Encode")
+	m, ok := plan.encodeMethod(funcName)
 
 	writerType := reflect.TypeOf((*Writer)(nil)).Elem()
-	if m.IsValid() && m.Type().NumIn() == 2 && m.Type().In(0) == writerType && m.Type().In(1) == fieldValue.Type() {
-		ret := m.Call([]reflect.Value{reflect.ValueOf(r), fieldValue})
+	if ok && m.Type.NumIn() == 3 && m.Type.In(1) == writerType && m.Type.In(2) == fieldValue.Type() {
+		ret := m.Func.Call([]reflect.Value{structValue, reflect.ValueOf(r), fieldValue})
 
 		errorType := reflect.TypeOf((*error)(nil)).Elem()
 
@@ -270,77 +438,228 @@ func calcLength(v any, parentStructValues []reflect.Value) (int, error) {
 		return 0, &InvalidUnmarshalError{reflect.TypeOf(v)}
 	}
 
-	fieldCount := rv.NumField()
-	valueType := rv.Type()
+	m := &marshal{nest: &nesting{max: DefaultMaxDepth}}
+	return m.calcStructLength(rv, parentStructValues)
+}
+
+func (m *marshal) calcStructLength(structValue reflect.Value, parentStructValues []reflect.Value) (int, error) {
+	err := m.nest.enter()
+	if err != nil {
+		return 0, err
+	}
+	defer m.nest.leave()
+
+	return m.fieldsLength(structValue, parentStructValues)
+}
 
-	sumLength := 0
-	for i := 0; i < fieldCount; i++ {
-		fieldType := valueType.Field(i)
-		tags, err := parseTag(fieldType.Tag.Get(tagName))
+// fieldsLength returns the length of a struct the nesting already counts.
+func (m *marshal) fieldsLength(structValue reflect.Value, parentStructValues []reflect.Value) (int, error) {
+	plan, err := getStructPlan(structValue.Type())
+	if err != nil {
+		return 0, err
+	}
+
+	if plan.hasSizeOf {
+		structValue, err = m.fillSizeOf(plan, structValue, parentStructValues)
 		if err != nil {
-			return 0, fmt.Errorf(`failed parseTag for field "%s": %w`, fieldType.Name, err)
+			return 0, err
 		}
+	}
 
-		fieldData, err := parseReadDataFromTags(rv, tags)
-		if err != nil {
-			return 0, fmt.Errorf(`failed parse ReadData from tags for field "%s": %w`, fieldType.Name, err)
+	sumLength := 0
+	for i := 0; i < len(plan.fields); i++ {
+		f := plan.fields[i]
+		if g := f.bitGroup; g != nil {
+			sumLength += g.size
+			i += len(g.fields) - 1
+			continue
+		}
+
+		var length int
+		if f.data.hasPadding() {
+			length, err = m.paddedLength(int64(sumLength), structValue, f, parentStructValues)
+		} else {
+			length, err = m.getValueLength(structValue, structValue.Field(f.index), f.data, parentStructValues)
 		}
-		fieldValue := rv.Field(i)
-		length := getValueLength(rv, fieldValue, fieldData, parentStructValues)
-		sumLength += length
 		if err != nil {
-			return 0, fmt.Errorf(`failed set value to field "%s": %w`, fieldType.Name, err)
+			return 0, fieldError(err, `failed calc length of field "%s"`, f.name)
 		}
+		sumLength += length
 	}
 	return sumLength, nil
 }
 
-func getValueLength(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) int {
-	switch fieldValue.Kind() {
+func (m *marshal) getValueLength(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) (int, error) {
+	if fieldData == nil {
+		fieldData = &fieldReadData{}
+	}
+
+	env := exprEnv{structValue, parentStructValues}
+	skip, err := fieldData.skip(env)
+	if err != nil || fieldData.Ignore || skip {
+		return 0, err
+	}
+
+	if fieldValue.Kind() == reflect.Ptr && fieldValue.Type() != bigIntType {
+		return m.pointerLength(structValue, fieldValue, fieldData, parentStructValues)
+	}
+
+	if fieldData.Size != nil {
+		size, err := fieldData.evalSize(env)
+		return int(size), err
+	}
+
+	if fieldData.Magic != nil {
+		return len(fieldData.Magic), nil
+	}
+
+	length, err := fieldData.evalLength(env)
+	if err != nil {
+		return 0, fmt.Errorf("eval len: %w", err)
+	}
+
+	if fieldData.Varint {
+		return varintLength(fieldValue, fieldData)
+	}
+
+	if fieldData.BCD {
+		if length == nil {
+			return 0, errors.New("need set tag with len for bcd")
+		}
+		return int(*length), nil
+	}
+
+	if fieldData.Time != "" {
+		return timeSize(fieldValue, fieldData, length)
+	}
+
+	if isBigIntType(fieldValue.Type()) {
+		return bigIntWidth(fieldValue, length)
+	}
+
+	if fieldData.Float16 != "" {
+		return 2, checkFloat16Kind(fieldValue)
+	}
+
+	if fieldData.scaled() {
+		return fieldData.scaledWidth(fieldValue, length)
+	}
+
+	if fieldData.Prefix != "" {
+		size, err := prefixSize(fieldValue, fieldData)
+		if err != nil {
+			return 0, err
+		}
+
+		// The count itself is not part of the payload
+		data := *fieldData
+		data.Prefix = ""
+		n, err := m.getValueLength(structValue, fieldValue, &data, parentStructValues)
+		return size + n, err
+	}
 
+	switch fieldValue.Kind() {
 	case reflect.Int8, reflect.Uint8:
-		if fieldData != nil && fieldData.Length != nil {
-			return int(*fieldData.Length)
+		if length != nil {
+			return int(*length), nil
 		}
-		return 1
+		return 1, nil
+	case reflect.Bool:
+		return 1, nil
 	case reflect.Int16, reflect.Uint16:
-		if fieldData != nil && fieldData.Length != nil {
-			return int(*fieldData.Length)
+		if length != nil {
+			return int(*length), nil
 		}
-		return 2
+		return 2, nil
 	case reflect.Int32, reflect.Uint32, reflect.Float32:
-		if fieldData != nil && fieldData.Length != nil {
-			return int(*fieldData.Length)
+		if length != nil {
+			return int(*length), nil
 		}
-		return 4
+		return 4, nil
 	case reflect.Int64, reflect.Uint64, reflect.Float64:
-		if fieldData != nil && fieldData.Length != nil {
-			return int(*fieldData.Length)
+		if length != nil {
+			return int(*length), nil
 		}
-		return 8
+		return 8, nil
 	case reflect.String:
-		return len([]byte(fieldValue.String()))
+		if length != nil {
+			return int(*length), nil
+		}
+
+		enc, err := getTextEncoding(fieldData.Encoding)
+		if err != nil {
+			return 0, err
+		}
+
+		b, err := enc.encodeString(fieldValue.String())
+		if err != nil {
+			return 0, err
+		}
+
+		if fieldData.Terminator != nil {
+			return terminatedLength(env, fieldData, b, enc.unitSize())
+		}
+		return len(b), nil
 	case reflect.Slice:
-		if fieldData.Length == nil {
-			*fieldData.Length = int64(fieldValue.Len())
+		if fieldData.Terminator != nil && fieldValue.Type().Elem().Kind() == reflect.Uint8 {
+			return terminatedLength(env, fieldData, fieldValue.Bytes(), 1)
 		}
 
-		elemSize := getValueLength(structValue, fieldValue.Index(0), fieldData.ElemFieldData, parentStructValues)
-		return int(*fieldData.Length) * elemSize
+		if fieldData.Until != nil {
+			return m.untilLength(structValue, fieldValue, fieldData, parentStructValues)
+		}
+
+		n := int64(fieldValue.Len())
+		if length != nil {
+			n = *length
+		}
+		return m.elemsLength(structValue, fieldValue, n, fieldData, parentStructValues)
 	case reflect.Array:
-		return fieldValue.Len()
+		n := int64(fieldValue.Len())
+		if length != nil && *length != 0 {
+			n = *length
+		}
+		return m.elemsLength(structValue, fieldValue, n, fieldData, parentStructValues)
+	case reflect.Map:
+		return m.mapLength(structValue, fieldValue, fieldData, parentStructValues)
 	case reflect.Struct:
-		if fieldData != nil && fieldData.Length != nil {
-			return int(*fieldData.Length)
+		if length != nil {
+			return int(*length), nil
 		}
-		// marshal(fieldValue.Interface(), append(parentStructValues, structValue))
-		sum, err := calcLength(fieldValue.Interface(), append(parentStructValues, structValue))
-		if err != nil {
-			panic("err: " + err.Error())
+		return m.calcStructLength(fieldValue, append(parentStructValues, structValue))
+	case reflect.Interface:
+		if fieldValue.IsNil() {
+			return 0, nil
 		}
-		return sum
+
+		value := fieldValue.Elem()
+		if value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
+		return m.getValueLength(structValue, value, nil, parentStructValues)
 	default: // reflect.Int:
-		panic(`type "` + fieldValue.Kind().String() + `" not supported`)
+		return 0, errors.New(`type "` + fieldValue.Kind().String() + `" not supported`)
+	}
+}
+
+// elemsLength returns the length of the first n elements of a slice or
+// array. Elements can differ in length, so each one is counted.
+func (m *marshal) elemsLength(structValue, fieldValue reflect.Value, n int64, fieldData *fieldReadData, parentStructValues []reflect.Value) (int, error) {
+	if n > int64(fieldValue.Len()) {
+		return 0, fmt.Errorf("len %d is more than the %d elements", n, fieldValue.Len())
+	}
+
+	if fieldData.ElemFieldData == nil && fieldValue.Type().Elem().Kind() == reflect.Uint8 {
+		return int(n), nil
+	}
+
+	sum := 0
+	for i := 0; i < int(n); i++ {
+		size, err := m.getValueLength(structValue, fieldValue.Index(i), fieldData.ElemFieldData, parentStructValues)
+		if err != nil {
+			return 0, err
+		}
+		sum += size
 	}
-	return 0
+	return sum, nil
 }
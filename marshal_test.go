@@ -29,7 +29,7 @@ func (a A) Float64IntEncode(w Writer, v float64) error {
 func Test_marshal_Marshal(t *testing.T) {
 
 	w := NewWriter(nil, true)
-	m := &marshal{w}
+	m := newMarshal(w)
 
 	a := A{-1, 2.2}
 	b, err := m.Marshal(a)
@@ -48,22 +48,21 @@ func Test_marshal_Marshal(t *testing.T) {
 
 // 小端编码
 type name struct {
-	LinkCode         uint16 `bin:"len:2"` // 链路码
-	SenderAdCode     uint32 `bin:"len:3"` // 发送方 行政规划码
-	SenderType       uint16 `bin:"len:2"` // 发送方 类型
-	SenderNumber     uint16 `bin:"len:2"` // 发送方 编号
-	ReceiverAdCode   uint32 `bin:"len:3"` // 接收方 行政规划码
-	ReceiveType      uint16 `bin:"len:2"` // 接收方 类型
-	ReceiverNumber   uint16 `bin:"len:2"` // 接收方 编号
-	TimeStamp        uint32 `bin:"len:4"` // 时间戳
-	TimeStampReserve uint16 `bin:"len:2"` // 时间戳预留位置
-	TTL              uint8  `bin:"len:1"` // 生存时间
-	Version          uint8  `bin:"len:1"` // 协议版本
-	Operation        uint8  `bin:"len:1"` // 操作类型
-	ObjectName       uint8  `bin:"len:1"` // 对象名称编码
-	ObjectType       uint8  `bin:"len:1"` // 对象类型
-	Signature        uint8  `bin:"len:1"` // 签名 0:无签名 1:有签名
-	Reserve          []byte `bin:"len:3"` // 保留 字段
+	LinkCode         uint16 `bin:"len:2"`       // 链路码
+	SenderAdCode     uint32 `bin:"len:3"`       // 发送方 行政规划码
+	SenderType       uint16 `bin:"len:2"`       // 发送方 类型
+	SenderNumber     uint16 `bin:"len:2"`       // 发送方 编号
+	ReceiverAdCode   uint32 `bin:"len:3"`       // 接收方 行政规划码
+	ReceiveType      uint16 `bin:"len:2"`       // 接收方 类型
+	ReceiverNumber   uint16 `bin:"len:2"`       // 接收方 编号
+	TimeStamp        uint32 `bin:"len:4"`       // 时间戳
+	TimeStampReserve uint16 `bin:"len:2"`       // 时间戳预留位置
+	TTL              uint8  `bin:"len:1"`       // 生存时间
+	Version          uint8  `bin:"len:1"`       // 协议版本
+	Operation        uint8  `bin:"len:1"`       // 操作类型
+	ObjectName       uint8  `bin:"len:1"`       // 对象名称编码
+	ObjectType       uint8  `bin:"len:1"`       // 对象类型
+	Signature        uint8  `bin:"len:1,pad:3"` // 签名 0:无签名 1:有签名, 3 字节保留
 	// Message
 	LightsMessage struct {
 		Length       uint16          `bin:"len:2,LengthWithoutSelf"` // 消息长度 Length
@@ -0,0 +1,160 @@
+package binstruct
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// WordSwappedBigEndian stores the 16-bit words of a value least
+	// significant first, each word big endian: 0x0A0B0C0D is 0C 0D 0A 0B
+	// (CDAB). Modbus devices commonly send 32-bit values this way.
+	WordSwappedBigEndian binary.ByteOrder = wordSwapped{name: "WordSwappedBigEndian"}
+	// WordSwappedLittleEndian stores the 16-bit words of a value most
+	// significant first, each word little endian: 0x0A0B0C0D is 0B 0A 0D 0C
+	// (BADC).
+	WordSwappedLittleEndian binary.ByteOrder = wordSwapped{name: "WordSwappedLittleEndian", little: true}
+)
+
+// byteOrders maps the values of the order tag to byte orders, the
+// letters are the bytes of a 32-bit value from most significant.
+var byteOrders = map[string]binary.ByteOrder{
+	"ABCD": binary.BigEndian,
+	"DCBA": binary.LittleEndian,
+	"CDAB": WordSwappedBigEndian,
+	"BADC": WordSwappedLittleEndian,
+}
+
+func parseOrder(v string) (binary.ByteOrder, error) {
+	order, ok := byteOrders[strings.ToUpper(strings.TrimSpace(v))]
+	if !ok {
+		return nil, errors.New("invalid order " + v + ", expected ABCD, DCBA, CDAB or BADC")
+	}
+	return order, nil
+}
+
+type wordSwapped struct {
+	name   string
+	little bool
+}
+
+// swap converts b between big endian and the word-swapped order, the
+// conversion is its own inverse.
+func (o wordSwapped) swap(b []byte) []byte {
+	s := make([]byte, len(b))
+	for i := 0; i+1 < len(b); i += 2 {
+		if o.little {
+			s[i], s[i+1] = b[i+1], b[i]
+		} else {
+			j := len(b) - 2 - i
+			s[j], s[j+1] = b[i], b[i+1]
+		}
+	}
+	return s
+}
+
+func (o wordSwapped) Uint16(b []byte) uint16 {
+	return binary.BigEndian.Uint16(o.swap(b[:2]))
+}
+
+func (o wordSwapped) Uint32(b []byte) uint32 {
+	return binary.BigEndian.Uint32(o.swap(b[:4]))
+}
+
+func (o wordSwapped) Uint64(b []byte) uint64 {
+	return binary.BigEndian.Uint64(o.swap(b[:8]))
+}
+
+func (o wordSwapped) PutUint16(b []byte, v uint16) {
+	binary.BigEndian.PutUint16(b, v)
+	copy(b, o.swap(b[:2]))
+}
+
+func (o wordSwapped) PutUint32(b []byte, v uint32) {
+	binary.BigEndian.PutUint32(b, v)
+	copy(b, o.swap(b[:4]))
+}
+
+func (o wordSwapped) PutUint64(b []byte, v uint64) {
+	binary.BigEndian.PutUint64(b, v)
+	copy(b, o.swap(b[:8]))
+}
+
+func (o wordSwapped) String() string {
+	return o.name
+}
+
+// toBigEndian returns b, an integer stored in order, as big endian bytes.
+// Any byte order works for integers of 1, 2, 4 and 8 bytes; other widths
+// need big, little or word-swapped (even widths) endian.
+func toBigEndian(order binary.ByteOrder, b []byte) ([]byte, error) {
+	switch {
+	case order == binary.BigEndian || len(b) == 1:
+		return b, nil
+	case order == nil:
+		return nil, errors.New("cannot determine endianness, byte order is not set")
+	case order == binary.LittleEndian:
+		return reverseBytes(b), nil
+	}
+
+	if o, ok := order.(wordSwapped); ok && len(b)%2 == 0 {
+		return o.swap(b), nil
+	}
+
+	be := make([]byte, len(b))
+	switch len(b) {
+	case 2:
+		binary.BigEndian.PutUint16(be, order.Uint16(b))
+	case 4:
+		binary.BigEndian.PutUint32(be, order.Uint32(b))
+	case 8:
+		binary.BigEndian.PutUint64(be, order.Uint64(b))
+	default:
+		return nil, orderWidthError(order, len(b))
+	}
+	return be, nil
+}
+
+// fromBigEndian returns the big endian integer b stored in order.
+func fromBigEndian(order binary.ByteOrder, b []byte) ([]byte, error) {
+	switch {
+	case order == binary.BigEndian || len(b) == 1:
+		return b, nil
+	case order == nil:
+		return nil, errors.New("cannot determine endianness, byte order is not set")
+	case order == binary.LittleEndian:
+		return reverseBytes(b), nil
+	}
+
+	if o, ok := order.(wordSwapped); ok && len(b)%2 == 0 {
+		return o.swap(b), nil
+	}
+
+	s := make([]byte, len(b))
+	switch len(b) {
+	case 2:
+		order.PutUint16(s, binary.BigEndian.Uint16(b))
+	case 4:
+		order.PutUint32(s, binary.BigEndian.Uint32(b))
+	case 8:
+		order.PutUint64(s, binary.BigEndian.Uint64(b))
+	default:
+		return nil, orderWidthError(order, len(b))
+	}
+	return s, nil
+}
+
+// reverseBytes returns a reversed copy of b.
+func reverseBytes(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, c := range b {
+		r[len(b)-1-i] = c
+	}
+	return r
+}
+
+func orderWidthError(order binary.ByteOrder, n int) error {
+	return fmt.Errorf("byte order %v can't be used for %d-byte integers", order, n)
+}
@@ -0,0 +1,105 @@
+package binstruct
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WordSwappedOrders(t *testing.T) {
+	b := make([]byte, 8)
+
+	WordSwappedBigEndian.PutUint32(b, 0x0A0B0C0D)
+	require.Equal(t, []byte{0x0C, 0x0D, 0x0A, 0x0B}, b[:4])
+	require.Equal(t, uint32(0x0A0B0C0D), WordSwappedBigEndian.Uint32(b))
+
+	WordSwappedLittleEndian.PutUint32(b, 0x0A0B0C0D)
+	require.Equal(t, []byte{0x0B, 0x0A, 0x0D, 0x0C}, b[:4])
+	require.Equal(t, uint32(0x0A0B0C0D), WordSwappedLittleEndian.Uint32(b))
+
+	WordSwappedBigEndian.PutUint64(b, 0x0102030405060708)
+	require.Equal(t, []byte{0x07, 0x08, 0x05, 0x06, 0x03, 0x04, 0x01, 0x02}, b)
+	require.Equal(t, uint64(0x0102030405060708), WordSwappedBigEndian.Uint64(b))
+
+	WordSwappedBigEndian.PutUint16(b, 0x0102)
+	require.Equal(t, []byte{0x01, 0x02}, b[:2])
+
+	require.Equal(t, "WordSwappedBigEndian", WordSwappedBigEndian.String())
+}
+
+// customOrder is a user-supplied byte order, here a plain little endian.
+type customOrder struct {
+	binary.ByteOrder
+}
+
+func Test_ReadWriteUintXOrders(t *testing.T) {
+	tests := []struct {
+		order binary.ByteOrder
+		x     int
+		data  []byte
+		want  uint64
+	}{
+		{binary.BigEndian, 3, []byte{0x01, 0x02, 0x03}, 0x010203},
+		{binary.LittleEndian, 3, []byte{0x03, 0x02, 0x01}, 0x010203},
+		{WordSwappedBigEndian, 4, []byte{0x03, 0x04, 0x01, 0x02}, 0x01020304},
+		{WordSwappedLittleEndian, 6, []byte{0x02, 0x01, 0x04, 0x03, 0x06, 0x05}, 0x010203040506},
+		{customOrder{binary.LittleEndian}, 4, []byte{0x04, 0x03, 0x02, 0x01}, 0x01020304},
+		{customOrder{binary.LittleEndian}, 1, []byte{0x01}, 0x01},
+	}
+
+	for _, tt := range tests {
+		r := NewReaderFromBytes(tt.data, tt.order, false)
+		v, err := r.ReadUintX(tt.x)
+		require.NoError(t, err, tt.order)
+		require.Equal(t, tt.want, v, tt.order)
+
+		w := NewWriter(tt.order, false)
+		require.NoError(t, w.WriteUintX(tt.want, tt.x), tt.order)
+		require.Equal(t, tt.data, w.Bytes(), tt.order)
+	}
+
+	r := NewReaderFromBytes([]byte{0x01, 0x02, 0x03}, customOrder{binary.LittleEndian}, false)
+	_, err := r.ReadUintX(3)
+	require.EqualError(t, err, "byte order LittleEndian can't be used for 3-byte integers")
+
+	w := NewWriter(WordSwappedBigEndian, false)
+	require.EqualError(t, w.WriteUintX(1, 3), "byte order WordSwappedBigEndian can't be used for 3-byte integers")
+	require.Empty(t, w.Bytes())
+}
+
+func Test_OrderTag(t *testing.T) {
+	type dataStruct struct {
+		Power   float32 `bin:"order:CDAB"`
+		Counter uint32  `bin:"order:BADC"`
+		Energy  int64   `bin:"len:6,order:cdab"`
+		Plain   uint16  `bin:"order:DCBA"`
+	}
+
+	data := []byte{
+		0x00, 0x00, 0x3F, 0xC0, // 1.5
+		0x02, 0x01, 0x04, 0x03,
+		0x05, 0x06, 0x03, 0x04, 0x01, 0x02,
+		0x02, 0x01,
+	}
+
+	want := dataStruct{Power: 1.5, Counter: 0x01020304, Energy: 0x010203040506, Plain: 0x0102}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	require.Equal(t, float32(1.5), math.Float32frombits(WordSwappedBigEndian.Uint32(data)))
+
+	_, err = MarshalBE(struct {
+		Value uint32 `bin:"order:ACBD"`
+	}{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid order ACBD, expected ABCD, DCBA, CDAB or BADC")
+}
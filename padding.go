@@ -0,0 +1,153 @@
+package binstruct
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// padding returns the number of bytes that move offset n to a multiple
+// of align.
+func padding(n int64, align int) int64 {
+	if align <= 1 {
+		return 0
+	}
+
+	if r := n % int64(align); r != 0 {
+		return int64(align) - r
+	}
+	return 0
+}
+
+func (d *fieldReadData) hasPadding() bool {
+	return d.Align > 0 || d.Pad > 0 || d.PadTo > 0
+}
+
+// alignPadding returns the padding before the field at offset pos. Offsets
+// are counted from the start of the input, or of the size section being
+// read, and from structStart for alignStruct.
+func (d *fieldReadData) alignPadding(pos, structStart int64) int64 {
+	if d.AlignStruct {
+		pos -= structStart
+	}
+	return padding(pos, d.Align)
+}
+
+// trailingPadding returns the padding after a field that starts at start
+// and ends at end.
+func (d *fieldReadData) trailingPadding(start, end int64) int64 {
+	n := int64(d.Pad)
+	return n + padding(end+n-start, d.PadTo)
+}
+
+func (u *unmarshal) setPaddedField(structStart int64, structValue reflect.Value, f fieldPlan, parentStructValues []reflect.Value) error {
+	data := f.data
+	skip, err := data.skip(exprEnv{structValue, parentStructValues})
+	if err != nil || skip || data.Ignore {
+		return err
+	}
+
+	pos, err := u.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	n := data.alignPadding(pos, structStart)
+	_, _, err = u.r.ReadBytes(int(n))
+	if err != nil {
+		return fmt.Errorf("align: %w", err)
+	}
+	pos += n
+
+	err = u.setValueToField(structValue, structValue.Field(f.index), data, parentStructValues)
+	if err != nil {
+		return err
+	}
+
+	end, err := u.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = u.r.ReadBytes(int(data.trailingPadding(pos, end)))
+	if err != nil {
+		return fmt.Errorf("pad: %w", err)
+	}
+
+	return nil
+}
+
+// position returns the output offset from the start of the current size
+// section.
+func (m *marshal) position() (int64, error) {
+	err := m.w.Flush()
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(m.w.Bytes()) - m.base), nil
+}
+
+func (m *marshal) writeFill(n int64, fill byte) error {
+	_, err := m.w.Write(bytes.Repeat([]byte{fill}, int(n)))
+	return err
+}
+
+func (m *marshal) writePaddedField(structStart int64, structValue reflect.Value, f fieldPlan, parentStructValues []reflect.Value) error {
+	data := f.data
+	skip, err := data.skip(exprEnv{structValue, parentStructValues})
+	if err != nil || skip || data.Ignore {
+		return err
+	}
+
+	pos, err := m.position()
+	if err != nil {
+		return err
+	}
+
+	n := data.alignPadding(pos, structStart)
+	err = m.writeFill(n, data.Fill)
+	if err != nil {
+		return fmt.Errorf("align: %w", err)
+	}
+	pos += n
+
+	err = m.setValueToField(structValue, structValue.Field(f.index), data, parentStructValues)
+	if err != nil {
+		return err
+	}
+
+	end, err := m.position()
+	if err != nil {
+		return err
+	}
+
+	err = m.writeFill(data.trailingPadding(pos, end), data.Fill)
+	if err != nil {
+		return fmt.Errorf("pad: %w", err)
+	}
+
+	return nil
+}
+
+// paddedLength returns the length of a field with its padding when the
+// field starts at offset pos of its struct. The struct is assumed to
+// start at an aligned offset.
+func (m *marshal) paddedLength(pos int64, structValue reflect.Value, f fieldPlan, parentStructValues []reflect.Value) (int, error) {
+	data := f.data
+	skip, err := data.skip(exprEnv{structValue, parentStructValues})
+	if err != nil || skip || data.Ignore {
+		return 0, err
+	}
+
+	n := padding(pos, data.Align)
+
+	length, err := m.getValueLength(structValue, structValue.Field(f.index), data, parentStructValues)
+	if err != nil {
+		return 0, err
+	}
+
+	start := pos + n
+	end := start + int64(length)
+	return int(end - pos + data.trailingPadding(start, end)), nil
+}
@@ -0,0 +1,227 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// structPlan is the compiled description of a struct type. It is built
+// once per type and shared by Unmarshal, Marshal and length calculation,
+// so processing many values of the same type does not parse tags again.
+type structPlan struct {
+	typ    reflect.Type
+	fields []fieldPlan
+
+	hasSizeOf  bool // some field is filled by Marshal with the size of another
+	hasPadding bool // some field is aligned or padded
+
+	decodeMethods sync.Map // method name -> reflect.Method on *T
+	encodeMethods sync.Map // method name -> reflect.Method on T
+}
+
+// fieldPlan describes one struct field. Tag values that depend on other
+// fields are kept as expressions and evaluated at run time.
+type fieldPlan struct {
+	index int
+	name  string
+	data  *fieldReadData
+
+	bitGroup *bitGroup  // set on the first member of a bit-field group
+	sizeOf   *fieldPlan // the field whose encoded length this one holds
+}
+
+var structPlans sync.Map // reflect.Type -> *structPlan
+
+// getStructPlan returns the cached plan for the struct type t,
+// compiling it on first use. It is safe for concurrent use.
+func getStructPlan(t reflect.Type) (*structPlan, error) {
+	if p, ok := structPlans.Load(t); ok {
+		return p.(*structPlan), nil
+	}
+
+	p, err := compileStructPlan(t)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := structPlans.LoadOrStore(t, p)
+	return actual.(*structPlan), nil
+}
+
+func compileStructPlan(t reflect.Type) (*structPlan, error) {
+	p := &structPlan{
+		typ:    t,
+		fields: make([]fieldPlan, t.NumField()),
+	}
+
+	for i := range p.fields {
+		fieldType := t.Field(i)
+		tags, err := parseTag(fieldType.Tag.Get(tagName))
+		if err != nil {
+			return nil, fmt.Errorf(`failed parseTag for field "%s": %w`, fieldType.Name, err)
+		}
+
+		fieldData, err := parseReadDataFromTags(tags)
+		if err != nil {
+			return nil, fmt.Errorf(`failed parse ReadData from tags for field "%s": %w`, fieldType.Name, err)
+		}
+
+		p.fields[i] = fieldPlan{
+			index: i,
+			name:  fieldType.Name,
+			data:  fieldData,
+		}
+
+		if fieldData.hasPadding() {
+			p.hasPadding = true
+		}
+
+		if fieldData.Magic != nil {
+			err = checkMagicSize(fieldType.Type, fieldData)
+			if err != nil {
+				return nil, fmt.Errorf(`field "%s": %w`, fieldType.Name, err)
+			}
+		}
+
+		err = checkStringUnits(fieldType.Type, fieldData)
+		if err != nil {
+			return nil, fmt.Errorf(`field "%s": %w`, fieldType.Name, err)
+		}
+
+		// Resolve custom methods up front, they are looked up on every call.
+		if fieldData.FuncName != "" {
+			p.decodeMethod(fieldData.FuncName)
+			p.encodeMethod(fieldData.FuncName)
+		}
+	}
+
+	for i := range p.fields {
+		name := p.fields[i].data.SizeOf
+		if name == "" {
+			continue
+		}
+
+		for j := range p.fields {
+			if p.fields[j].name == name {
+				p.fields[i].sizeOf = &p.fields[j]
+			}
+		}
+
+		if p.fields[i].sizeOf == nil {
+			return nil, fmt.Errorf(`field "%s" is sizeOf unknown field "%s"`, p.fields[i].name, name)
+		}
+		p.hasSizeOf = true
+	}
+
+	err := compileBitGroups(t, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// decodeMethod returns the {{name}}Decode method declared on the struct
+// or its pointer. The lookup result is cached.
+func (p *structPlan) decodeMethod(name string) (reflect.Method, bool) {
+	if m, ok := p.decodeMethods.Load(name); ok {
+		method := m.(reflect.Method)
+		return method, method.Func.IsValid()
+	}
+
+	method, ok := reflect.PointerTo(p.typ).MethodByName(name + "Decode")
+	p.decodeMethods.Store(name, method)
+	return method, ok
+}
+
+// encodeMethod returns the {{name}}Encode method declared on the struct
+// value. The lookup result is cached.
+func (p *structPlan) encodeMethod(name string) (reflect.Method, bool) {
+	if m, ok := p.encodeMethods.Load(name); ok {
+		method := m.(reflect.Method)
+		return method, method.Func.IsValid()
+	}
+
+	method, ok := p.typ.MethodByName(name + "Encode")
+	p.encodeMethods.Store(name, method)
+	return method, ok
+}
+
+// checkMagicSize checks that a magic is exactly as long as its field.
+// Unmarshal decodes the field after checking the magic while Marshal
+// writes only the magic, so the sizes must agree.
+func checkMagicSize(t reflect.Type, fieldData *fieldReadData) error {
+	size, ok := staticSize(t, fieldData)
+	if !ok {
+		return errors.New("magic needs a field of fixed size, such as [4]byte or uint32")
+	}
+
+	if size != len(fieldData.Magic) {
+		return fmt.Errorf("magic of %d bytes doesn't match the %d-byte field", len(fieldData.Magic), size)
+	}
+	return nil
+}
+
+// staticSize returns the encoded size of a value of type t if it is known
+// without reading any data.
+func staticSize(t reflect.Type, fieldData *fieldReadData) (int, bool) {
+	if fieldData == nil {
+		fieldData = &fieldReadData{}
+	}
+
+	var length int64
+	hasLength := fieldData.Length != nil
+	if hasLength {
+		var ok bool
+		length, ok = constValue(fieldData.Length)
+		if !ok {
+			return 0, false
+		}
+	}
+
+	fixed := func(n int64) (int, bool) {
+		if hasLength {
+			return int(length), true
+		}
+		return int(n), n > 0
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return 1, true
+	case reflect.Int8, reflect.Uint8:
+		return fixed(1)
+	case reflect.Int16, reflect.Uint16:
+		return fixed(2)
+	case reflect.Int32, reflect.Uint32:
+		return fixed(4)
+	case reflect.Int64, reflect.Uint64:
+		return fixed(8)
+	case reflect.Int, reflect.Uint:
+		return fixed(0)
+	case reflect.Float32:
+		return 4, true
+	case reflect.Float64:
+		return 8, true
+	case reflect.String:
+		return fixed(0)
+	case reflect.Array, reflect.Slice:
+		n := int64(0)
+		if t.Kind() == reflect.Array {
+			n = int64(t.Len())
+		}
+		if hasLength && length != 0 {
+			n = length
+		}
+		if n == 0 {
+			return 0, t.Kind() == reflect.Array || hasLength
+		}
+
+		elem, ok := staticSize(t.Elem(), fieldData.ElemFieldData)
+		return int(n) * elem, ok
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,99 @@
+package binstruct
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_getStructPlanCached(t *testing.T) {
+	type dataStruct struct {
+		Len uint8
+		Str string `bin:"len:Len"`
+	}
+
+	typ := reflect.TypeOf(dataStruct{})
+
+	p1, err := getStructPlan(typ)
+	require.NoError(t, err)
+	p2, err := getStructPlan(typ)
+	require.NoError(t, err)
+	require.True(t, p1 == p2)
+
+	require.Len(t, p1.fields, 2)
+	require.Equal(t, "Str", p1.fields[1].name)
+	require.Equal(t, fieldExpr{"Len"}, p1.fields[1].data.Length)
+}
+
+func Test_getStructPlanError(t *testing.T) {
+	type dataStruct struct {
+		Arr []byte `bin:"["`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{}, &actual)
+	require.EqualError(t, err, `failed parseTag for field "Arr": unbalanced square bracket`)
+}
+
+func Test_UnmarshalConcurrent(t *testing.T) {
+	type record struct {
+		Len uint8
+		Str string `bin:"len:Len"`
+	}
+
+	type dataStruct struct {
+		Count   uint8
+		Records []record `bin:"len:Count"`
+	}
+
+	data := []byte{0x02, 0x02, 'h', 'i', 0x03, 'y', 'a', 'y'}
+	want := dataStruct{
+		Count:   2,
+		Records: []record{{Len: 2, Str: "hi"}, {Len: 3, Str: "yay"}},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var actual dataStruct
+			err := UnmarshalBE(data, &actual)
+			require.NoError(t, err)
+			require.Equal(t, want, actual)
+		}()
+	}
+	wg.Wait()
+}
+
+func Benchmark_UnmarshalRecords(b *testing.B) {
+	type record struct {
+		ID    uint32
+		Value int16
+		Len   uint8
+		Name  string `bin:"len:Len"`
+	}
+
+	type dataStruct struct {
+		Count   uint16
+		Records []record `bin:"len:Count"`
+	}
+
+	const count = 1000
+	data := []byte{count >> 8, count & 0xff}
+	for i := 0; i < count; i++ {
+		data = append(data, 0x00, 0x00, 0x00, byte(i), 0x00, 0x01, 0x02, 'h', 'i')
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var actual dataStruct
+		if err := UnmarshalBE(data, &actual); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
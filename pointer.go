@@ -0,0 +1,91 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// setPointer allocates the value of a pointer field and decodes it. With
+// optional, a zero presence byte leaves the pointer nil.
+func (u *unmarshal) setPointer(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
+	if fieldData.Optional {
+		present, err := u.r.ReadBool()
+		if err != nil {
+			return fmt.Errorf("read presence: %w", err)
+		}
+
+		if !present {
+			if fieldValue.CanSet() {
+				fieldValue.Set(reflect.Zero(fieldValue.Type()))
+			}
+			return nil
+		}
+	}
+
+	value := fieldValue
+	if value.IsNil() {
+		value = reflect.New(fieldValue.Type().Elem())
+	}
+
+	err := u.setValueToField(structValue, value.Elem(), pointerData(fieldData), parentStructValues)
+	if err != nil {
+		return err
+	}
+
+	if fieldValue.CanSet() {
+		fieldValue.Set(value)
+	}
+	return nil
+}
+
+// writePointer encodes the value of a pointer field. A nil pointer is only
+// allowed with optional, or when an if tag skips the field.
+func (m *marshal) writePointer(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
+	if fieldData.Optional {
+		err := m.w.WriteByte(presenceByte(fieldValue))
+		if err != nil {
+			return err
+		}
+	}
+
+	if fieldValue.IsNil() {
+		if fieldData.Optional {
+			return nil
+		}
+		return errors.New("nil pointer, use the if or optional tag for optional data")
+	}
+
+	return m.setValueToField(structValue, fieldValue.Elem(), pointerData(fieldData), parentStructValues)
+}
+
+func (m *marshal) pointerLength(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) (int, error) {
+	n := 0
+	if fieldData.Optional {
+		n = 1
+	}
+
+	if fieldValue.IsNil() {
+		return n, nil
+	}
+
+	length, err := m.getValueLength(structValue, fieldValue.Elem(), pointerData(fieldData), parentStructValues)
+	return n + length, err
+}
+
+// pointerData returns the field data for the value a pointer points to.
+// The presence byte belongs to the pointer.
+func pointerData(fieldData *fieldReadData) *fieldReadData {
+	if !fieldData.Optional {
+		return fieldData
+	}
+
+	return fieldData.Pointee
+}
+
+func presenceByte(v reflect.Value) byte {
+	if v.IsNil() {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,159 @@
+package binstruct
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type treeNode struct {
+	Value uint8
+	Left  *treeNode `bin:"optional"`
+	Right *treeNode `bin:"optional"`
+}
+
+func Test_PointerRecursive(t *testing.T) {
+	data := []byte{
+		0x01,
+		0x01, 0x02, 0x00, 0x00, // left leaf
+		0x01, 0x03, 0x00, 0x00, // right leaf
+	}
+
+	var actual treeNode
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, treeNode{
+		Value: 1,
+		Left:  &treeNode{Value: 2},
+		Right: &treeNode{Value: 3},
+	}, actual)
+
+	got, err := MarshalBE(actual)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	length, err := calcLength(actual, nil)
+	require.NoError(t, err)
+	require.Equal(t, len(data), length)
+}
+
+func Test_PointerIf(t *testing.T) {
+	type extra struct {
+		A uint16
+	}
+
+	type dataStruct struct {
+		HasExtra bool
+		Extra    *extra  `bin:"if:HasExtra"`
+		Count    *uint32 `bin:"le"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x00, 0x05, 0x00, 0x00, 0x00}, &actual)
+	require.NoError(t, err)
+	require.Nil(t, actual.Extra)
+	require.Equal(t, uint32(5), *actual.Count)
+
+	err = UnmarshalBE([]byte{0x01, 0x00, 0x07, 0x05, 0x00, 0x00, 0x00}, &actual)
+	require.NoError(t, err)
+	require.Equal(t, &extra{A: 7}, actual.Extra)
+
+	count := uint32(5)
+	got, err := MarshalBE(dataStruct{Count: &count})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x00, 0x05, 0x00, 0x00, 0x00}, got)
+
+	_, err = MarshalBE(dataStruct{HasExtra: true})
+	require.EqualError(t, err, `failed set value to field "Extra": nil pointer, use the if or optional tag for optional data`)
+}
+
+func Test_PointerMaxDepth(t *testing.T) {
+	// A degenerate tree nested deeper than the limit
+	data := bytes.Repeat([]byte{0x00, 0x01}, 20)
+
+	var actual treeNode
+	decoder := NewDecoder(bytes.NewReader(data), binary.BigEndian)
+	decoder.SetMaxDepth(10)
+	err := decoder.Decode(&actual)
+	require.True(t, errors.Is(err, ErrMaxDepth))
+
+	// Only the innermost field is named, the error doesn't grow with the depth
+	require.EqualError(t, err, `failed set value to field "Left": binstruct: maximum nesting depth exceeded`)
+}
+
+func Test_EncoderMaxDepth(t *testing.T) {
+	root := &treeNode{}
+	node := root
+	for i := 0; i < 20; i++ {
+		node.Right = &treeNode{}
+		node = node.Right
+	}
+
+	encoder := NewEncoder(nil, binary.BigEndian)
+	encoder.SetMaxDepth(10)
+	_, err := encoder.Encode(*root)
+	require.True(t, errors.Is(err, ErrMaxDepth))
+
+	encoder.SetMaxDepth(0)
+	_, err = encoder.Encode(*root)
+	require.NoError(t, err)
+
+	// A cycle stops at DefaultMaxDepth
+	node.Right = root
+	_, err = MarshalBE(*root)
+	require.EqualError(t, err, `failed set value to field "Right": binstruct: maximum nesting depth exceeded`)
+}
+
+type customNode struct {
+	Value uint8
+	Next  []customNode `bin:"Next"`
+}
+
+func (n *customNode) NextDecode(r Reader) ([]customNode, error) {
+	more, err := r.ReadByte()
+	if err != nil || more == 0 {
+		return nil, err
+	}
+
+	next := make([]customNode, 1)
+	return next, r.Unmarshal(&next[0])
+}
+
+func (n customNode) NextEncode(w Writer, v []customNode) error {
+	if len(v) == 0 {
+		return w.WriteByte(0)
+	}
+
+	err := w.WriteByte(1)
+	if err != nil {
+		return err
+	}
+	_, err = w.Marshal(v[0])
+	return err
+}
+
+func Test_MaxDepthFromCustomMethods(t *testing.T) {
+	// Unmarshal and Marshal called by the methods continue the depth
+	data := append(bytes.Repeat([]byte{0x00, 0x01}, 20), 0x00, 0x00)
+
+	var actual customNode
+	decoder := NewDecoder(bytes.NewReader(data), binary.BigEndian)
+	decoder.SetMaxDepth(10)
+	err := decoder.Decode(&actual)
+	require.True(t, errors.Is(err, ErrMaxDepth))
+
+	err = UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+
+	encoder := NewEncoder(nil, binary.BigEndian)
+	encoder.SetMaxDepth(10)
+	_, err = encoder.Encode(actual)
+	require.True(t, errors.Is(err, ErrMaxDepth))
+
+	got, err := MarshalBE(actual)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
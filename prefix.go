@@ -0,0 +1,154 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+const prefixVarint = "varint"
+
+// prefixWidths maps the values of the prefix tag to the width of the
+// count in bytes. A varint count has no fixed width.
+var prefixWidths = map[string]int{
+	"u8":         1,
+	"u16":        2,
+	"u32":        4,
+	"u64":        8,
+	prefixVarint: 0,
+}
+
+func parsePrefix(v string) (string, error) {
+	if _, ok := prefixWidths[v]; !ok {
+		return "", errors.New("invalid prefix " + v + ", expected u8, u16, u32, u64 or varint")
+	}
+	return v, nil
+}
+
+func checkPrefixKind(fieldValue reflect.Value) error {
+	switch fieldValue.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return nil
+	default:
+		return errors.New(`prefix is not supported for type "` + fieldValue.Kind().String() + `"`)
+	}
+}
+
+// readPrefix reads the count of a length-prefixed field: the number of
+// bytes of a string or the number of elements of a slice or map.
+func readPrefix(r Reader, fieldValue reflect.Value, prefix string) (*int64, error) {
+	err := checkPrefixKind(fieldValue)
+	if err != nil {
+		return nil, err
+	}
+
+	var n uint64
+	if prefix == prefixVarint {
+		n, err = r.ReadUvarint()
+	} else {
+		n, err = r.ReadUintX(prefixWidths[prefix])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read prefix: %w", err)
+	}
+
+	if n > math.MaxInt64 {
+		return nil, fmt.Errorf("prefix %d is too large", n)
+	}
+
+	// A string can't be longer than the rest of the input
+	if fieldValue.Kind() == reflect.String {
+		left, err := remaining(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if n > uint64(left) {
+			return nil, fmt.Errorf("prefix %d is more than the %d bytes left", n, left)
+		}
+	}
+
+	length := int64(n)
+	return &length, nil
+}
+
+// prefixCount returns the count of a length-prefixed field: the number of
+// encoded bytes of a string or the number of elements of a slice or map.
+func prefixCount(fieldValue reflect.Value, fieldData *fieldReadData) (uint64, error) {
+	err := checkPrefixKind(fieldValue)
+	if err != nil {
+		return 0, err
+	}
+
+	if fieldValue.Kind() != reflect.String {
+		return uint64(fieldValue.Len()), nil
+	}
+
+	enc, err := getTextEncoding(fieldData.Encoding)
+	if err != nil {
+		return 0, err
+	}
+
+	b, err := enc.encodeString(fieldValue.String())
+	return uint64(len(b)), err
+}
+
+// writePrefix writes the count of a length-prefixed field and returns it.
+func writePrefix(w Writer, fieldValue reflect.Value, fieldData *fieldReadData) (*int64, error) {
+	n, err := prefixCount(fieldValue, fieldData)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fieldData.Prefix
+	if prefix == prefixVarint {
+		err = w.WriteUvarint(n)
+	} else {
+		width := prefixWidths[prefix]
+		if width < 8 && n >= 1<<(8*uint(width)) {
+			return nil, fmt.Errorf("length %d does not fit in prefix %s", n, prefix)
+		}
+		err = w.WriteUintX(n, width)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	length := int64(n)
+	return &length, nil
+}
+
+// prefixSize returns the number of bytes writePrefix writes.
+func prefixSize(fieldValue reflect.Value, fieldData *fieldReadData) (int, error) {
+	n, err := prefixCount(fieldValue, fieldData)
+	if err != nil {
+		return 0, err
+	}
+
+	if fieldData.Prefix == prefixVarint {
+		return uvarintSize(n), nil
+	}
+	return prefixWidths[fieldData.Prefix], nil
+}
+
+// remaining returns the number of bytes left to read.
+func remaining(r Reader) (int64, error) {
+	cur, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.Seek(cur, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	return end - cur, nil
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/big"
 )
 
 var (
@@ -15,6 +16,34 @@ var (
 	ErrNegativeCount = errors.New("binstruct: negative count")
 )
 
+// maxReadAlloc is the largest count ReadBytes allocates before reading.
+const maxReadAlloc = 1 << 16
+
+// DefaultMaxDepth limits how deep structs can be nested, through pointer
+// fields of recursive types for example, before Unmarshal and Marshal
+// return ErrMaxDepth. Zero means no limit.
+var DefaultMaxDepth = 1000
+
+// nesting counts the structs being decoded or encoded. Readers and writers
+// derived from one another share it, so Unmarshal or Marshal called from a
+// custom method continues the depth of its caller.
+type nesting struct {
+	max   int // zero means no limit
+	depth int
+}
+
+func (n *nesting) enter() error {
+	if n.max > 0 && n.depth >= n.max {
+		return ErrMaxDepth
+	}
+	n.depth++
+	return nil
+}
+
+func (n *nesting) leave() {
+	n.depth--
+}
+
 // Reader is the interface that wraps the binstruct reader methods.
 type Reader interface {
 	io.ReadSeeker
@@ -55,17 +84,39 @@ type Reader interface {
 	// ReadIntX read X bytes and return int64 value
 	ReadIntX(x int) (int64, error)
 
+	// ReadUvarint reads an unsigned LEB128 varint (protobuf, MQTT style)
+	// and returns uint64 value
+	ReadUvarint() (uint64, error)
+	// ReadVarint reads a zigzag encoded varint and returns int64 value
+	ReadVarint() (int64, error)
+
+	// ReadBigInt read n bytes and return the integer, two's complement if signed
+	ReadBigInt(n int, signed bool) (*big.Int, error)
+
+	// ReadFloat16 read two bytes of IEEE 754 half precision and return float32 value
+	ReadFloat16() (float32, error)
+	// ReadBFloat16 read two bytes of bfloat16 and return float32 value
+	ReadBFloat16() (float32, error)
 	// ReadFloat32 read four bytes and return float32 value
 	ReadFloat32() (float32, error)
 	// ReadFloat64 read eight bytes and return float64 value
 	ReadFloat64() (float64, error)
 
+	// ReadBits reads n bits (up to 64) in the reader bit order and returns
+	// them as the low bits of the result. Byte reads and Seek discard
+	// the unread bits of a partially consumed byte.
+	ReadBits(n int) (uint64, error)
+	// AlignToByte discards the unread bits of a partially consumed byte
+	AlignToByte()
+
 	// Unmarshal parses the binary data and stores the result
 	// in the value pointed to by v.
 	Unmarshal(v interface{}) error
 
 	// WithOrder changes the byte order for the new Reader
 	WithOrder(order binary.ByteOrder) Reader
+	// WithBitOrder changes the bit order of ReadBits for the new Reader
+	WithBitOrder(order BitOrder) Reader
 }
 
 // NewReader returns a new reader that reads from r with byte order.
@@ -74,6 +125,8 @@ func NewReader(r io.ReadSeeker, order binary.ByteOrder, debug bool) Reader {
 	return &reader{
 		r:     r,
 		order: order,
+		bits:  &bitState{},
+		nest:  &nesting{max: DefaultMaxDepth},
 		debug: debug,
 	}
 }
@@ -88,6 +141,10 @@ type reader struct {
 	r     io.ReadSeeker
 	order binary.ByteOrder
 
+	bitOrder BitOrder
+	bits     *bitState // count is the unread bits left in buf
+
+	nest  *nesting
 	debug bool
 }
 
@@ -111,8 +168,20 @@ func (r *reader) ReadBytes(n int) (an int, b []byte, err error) {
 		return 0, []byte{}, nil
 	}
 
-	b = make([]byte, n)
-	an, err = io.ReadFull(r, b)
+	if n <= maxReadAlloc {
+		b = make([]byte, n)
+		an, err = io.ReadFull(r, b)
+	} else {
+		// n may come from the input, the buffer grows as the data arrives
+		b, err = io.ReadAll(io.LimitReader(r, int64(n)))
+		an = len(b)
+		if err == nil && an < n {
+			err = io.ErrUnexpectedEOF
+			if an == 0 {
+				err = io.EOF
+			}
+		}
+	}
 
 	if r.debug {
 		fmt.Printf("Read(want: %d|actual: %d): %s", n, an, hex.Dump(b))
@@ -182,22 +251,16 @@ func (r *reader) ReadUintX(x int) (uint64, error) {
 		return 0, err
 	}
 
-	switch r.order {
-	case binary.BigEndian:
-		for j := 0; j < x; j++ {
-			i |= uint64(b[x-j-1]) << (8 * j)
-		}
-
-	case binary.LittleEndian:
-		for j := 0; j < x; j++ {
-			i |= uint64(b[j]) << (8 * j)
-		}
+	b, err = toBigEndian(r.order, b)
+	if err != nil {
+		return 0, err
+	}
 
-	default:
-		err = errors.New("cannot determine endianness for custom (u)int length read")
+	for _, c := range b {
+		i = i<<8 | uint64(c)
 	}
 
-	return i, err
+	return i, nil
 }
 
 func (r *reader) ReadInt8() (int8, error) {
@@ -233,6 +296,77 @@ func (r *reader) ReadIntX(x int) (int64, error) {
 	return i, nil
 }
 
+func (r *reader) ReadUvarint() (uint64, error) {
+	var u uint64
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if i > 0 && errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		// The tenth byte holds the last bit of a 64-bit value
+		if i == binary.MaxVarintLen64-1 && b > 1 {
+			return 0, ErrVarintOverflow
+		}
+
+		u |= uint64(b&0x7F) << (7 * i)
+		if b < 0x80 {
+			return u, nil
+		}
+	}
+
+	return 0, ErrVarintOverflow
+}
+
+func (r *reader) ReadVarint() (int64, error) {
+	u, err := r.ReadUvarint()
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (r *reader) ReadBigInt(n int, signed bool) (*big.Int, error) {
+	_, b, err := r.ReadBytes(n)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = toBigEndian(r.order, b)
+	if err != nil {
+		return nil, err
+	}
+
+	v := new(big.Int).SetBytes(b)
+	if signed && n > 0 && b[0]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(8*n)))
+	}
+
+	return v, nil
+}
+
+func (r *reader) ReadFloat16() (float32, error) {
+	h, err := r.ReadUint16()
+	if err != nil {
+		return 0, err
+	}
+
+	return float16ToFloat32(h), nil
+}
+
+func (r *reader) ReadBFloat16() (float32, error) {
+	b, err := r.ReadUint16()
+	if err != nil {
+		return 0, err
+	}
+
+	return bfloat16ToFloat32(b), nil
+}
+
 func (r *reader) ReadFloat32() (float32, error) {
 	b, err := r.ReadUint32()
 	if err != nil {
@@ -253,13 +387,59 @@ func (r *reader) ReadFloat64() (float64, error) {
 	return float, nil
 }
 
+func (r *reader) ReadBits(n int) (uint64, error) {
+	if n < 0 {
+		return 0, ErrNegativeCount
+	}
+
+	if n > 64 {
+		return 0, errors.New("cannot read more than 64 bits")
+	}
+
+	var v uint64
+	for i := 0; i < n; i++ {
+		if r.bits.count == 0 {
+			var b [1]byte
+			_, err := io.ReadFull(r.r, b[:])
+			if err != nil {
+				if i > 0 && errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+
+			r.bits.buf = b[0]
+			r.bits.count = 8
+		}
+
+		r.bits.count--
+		if r.bitOrder == LSBFirst {
+			v |= uint64(r.bits.buf>>(7-r.bits.count)&1) << i
+		} else {
+			v = v<<1 | uint64(r.bits.buf>>r.bits.count&1)
+		}
+	}
+
+	if r.debug {
+		fmt.Printf("ReadBits(%d): %#x\n", n, v)
+	}
+
+	return v, nil
+}
+
+func (r *reader) AlignToByte() {
+	r.bits.count = 0
+}
+
 // io.Reader
 func (r *reader) Read(p []byte) (n int, err error) {
+	r.AlignToByte()
 	return r.r.Read(p)
 }
 
 // io.Seeker
 func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	r.AlignToByte()
 	i, err := r.r.Seek(offset, whence)
 
 	if r.debug {
@@ -290,10 +470,28 @@ func (r *reader) Peek(n int) ([]byte, error) {
 }
 
 func (r *reader) Unmarshal(v interface{}) error {
-	u := &unmarshal{r}
+	u := &unmarshal{r: r, nest: r.nest}
 	return u.Unmarshal(v)
 }
 
 func (r *reader) WithOrder(order binary.ByteOrder) Reader {
-	return NewReader(r, order, r.debug)
+	return &reader{
+		r:        r,
+		order:    order,
+		bitOrder: r.bitOrder,
+		bits:     r.bits,
+		nest:     r.nest,
+		debug:    r.debug,
+	}
+}
+
+func (r *reader) WithBitOrder(order BitOrder) Reader {
+	return &reader{
+		r:        r,
+		order:    r.order,
+		bitOrder: order,
+		bits:     r.bits,
+		nest:     r.nest,
+		debug:    r.debug,
+	}
 }
@@ -0,0 +1,196 @@
+package binstruct
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReadBits(t *testing.T) {
+	data := []byte{0xb5, 0x3c, 0xff}
+
+	r := NewReaderFromBytes(data, binary.BigEndian, false)
+
+	v, err := r.ReadBits(3) // 101
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), v)
+
+	v, err = r.ReadBits(9) // 10101 0011
+	require.NoError(t, err)
+	require.Equal(t, uint64(0x153), v)
+
+	r.AlignToByte() // skip 1100
+
+	b, err := r.ReadByte()
+	require.NoError(t, err)
+	require.Equal(t, byte(0xff), b)
+
+	_, err = r.ReadBits(1)
+	require.Equal(t, io.EOF, err)
+}
+
+func Test_ReadBitsLSBFirst(t *testing.T) {
+	data := []byte{0xb5, 0x3c}
+
+	r := NewReaderFromBytes(data, binary.BigEndian, false).WithBitOrder(LSBFirst)
+
+	v, err := r.ReadBits(3) // 101
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), v)
+
+	v, err = r.ReadBits(9) // 0 1011 0110 from 10110 and 1100
+	require.NoError(t, err)
+	require.Equal(t, uint64(0x196), v)
+
+	_, err = r.ReadBits(8)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func Test_ReadBitsByteReadAligns(t *testing.T) {
+	r := NewReaderFromBytes([]byte{0xf0, 0x01}, binary.BigEndian, false)
+
+	v, err := r.ReadBits(4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0xf), v)
+
+	b, err := r.ReadByte()
+	require.NoError(t, err)
+	require.Equal(t, byte(0x01), b)
+}
+
+func Test_ReadBitsDerivedReader(t *testing.T) {
+	r := NewReaderFromBytes([]byte{0xab, 0xcd}, binary.BigEndian, false)
+
+	v, err := r.ReadBits(4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0xa), v)
+
+	// the derived reader continues in the same byte
+	v, err = r.WithOrder(binary.LittleEndian).ReadBits(4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0xb), v)
+
+	v, err = r.WithBitOrder(LSBFirst).ReadBits(4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0xd), v)
+}
+
+func Test_ReadBitsInvalid(t *testing.T) {
+	r := NewReaderFromBytes([]byte{}, binary.BigEndian, false)
+
+	_, err := r.ReadBits(-1)
+	require.Equal(t, ErrNegativeCount, err)
+
+	_, err = r.ReadBits(65)
+	require.EqualError(t, err, "cannot read more than 64 bits")
+}
+
+type bitPackedSensor struct {
+	Values []uint16 `bin:"len:3,[Sample]"`
+	Tail   uint8
+}
+
+func (s *bitPackedSensor) SampleDecode(r Reader) (uint16, error) {
+	v, err := r.ReadBits(12)
+	return uint16(v), err
+}
+
+func (s bitPackedSensor) SampleEncode(w Writer, v uint16) error {
+	return w.WriteBits(uint64(v), 12)
+}
+
+func Test_BitsFromCustomMethods(t *testing.T) {
+	// three 12-bit samples in 4.5 bytes, the rest of the byte is padding
+	data := []byte{0x12, 0x34, 0x56, 0x78, 0x90, 0x2a}
+
+	var actual bitPackedSensor
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, bitPackedSensor{Values: []uint16{0x123, 0x456, 0x789}, Tail: 0x2a}, actual)
+
+	got, err := MarshalBE(actual)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+type bitFlagsHeader struct {
+	Flags uint8  `bin:"Flags"`
+	Value uint16 `bin:"le"`
+}
+
+func (h *bitFlagsHeader) FlagsDecode(r Reader) (uint8, error) {
+	v, err := r.ReadBits(3)
+	return uint8(v), err
+}
+
+func (h bitFlagsHeader) FlagsEncode(w Writer, v uint8) error {
+	return w.WriteBits(uint64(v), 3)
+}
+
+func Test_BitsBeforeFieldWithOrder(t *testing.T) {
+	data := []byte{0xe0, 0x02, 0x01}
+
+	got, err := MarshalBE(bitFlagsHeader{Flags: 7, Value: 0x0102})
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	var actual bitFlagsHeader
+	err = UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, bitFlagsHeader{Flags: 7, Value: 0x0102}, actual)
+}
+
+func Test_ReadBytesLargeCount(t *testing.T) {
+	r := NewReaderFromBytes([]byte{0x01, 0x02}, binary.BigEndian, false)
+
+	// The count is not allocated before the data is read
+	an, b, err := r.ReadBytes(math.MaxInt32)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	require.Equal(t, 2, an)
+	require.Equal(t, []byte{0x01, 0x02}, b)
+
+	_, _, err = r.ReadBytes(math.MaxInt32)
+	require.Equal(t, io.EOF, err)
+}
+
+func Test_ReadVarint(t *testing.T) {
+	data := []byte{
+		0x96, 0x01, // 150
+		0x03,                                                       // zigzag -2
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, // max uint64
+	}
+
+	r := NewReaderFromBytes(data, binary.BigEndian, false)
+
+	u, err := r.ReadUvarint()
+	require.NoError(t, err)
+	require.Equal(t, uint64(150), u)
+
+	i, err := r.ReadVarint()
+	require.NoError(t, err)
+	require.Equal(t, int64(-2), i)
+
+	u, err = r.ReadUvarint()
+	require.NoError(t, err)
+	require.Equal(t, uint64(math.MaxUint64), u)
+
+	_, err = r.ReadUvarint()
+	require.Equal(t, io.EOF, err)
+}
+
+func Test_ReadVarintInvalid(t *testing.T) {
+	r := NewReaderFromBytes([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}, binary.BigEndian, false)
+	_, err := r.ReadUvarint()
+	require.Equal(t, ErrVarintOverflow, err)
+
+	r = NewReaderFromBytes([]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}, binary.BigEndian, false)
+	_, err = r.ReadUvarint()
+	require.Equal(t, ErrVarintOverflow, err)
+
+	r = NewReaderFromBytes([]byte{0x96}, binary.BigEndian, false)
+	_, err = r.ReadUvarint()
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
@@ -0,0 +1,168 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// roundFuncs are the values of the round tag, the rounding Marshal applies
+// to a scaled value before it is stored as an integer.
+var roundFuncs = map[string]func(float64) float64{
+	"nearest": math.Round, // halfway values away from zero
+	"even":    math.RoundToEven,
+	"down":    math.Floor,
+	"up":      math.Ceil,
+	"zero":    math.Trunc,
+}
+
+func parseScale(v string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || f == 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, errors.New("scale must be a non-zero number, got " + v)
+	}
+	return f, nil
+}
+
+func parseBias(v string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, errors.New("bias must be a number, got " + v)
+	}
+	return f, nil
+}
+
+// parseFixed parses a Q format such as 16.16, integer bits and fraction
+// bits that add up to a whole number of bytes.
+func parseFixed(v string) (int, int, error) {
+	invalid := errors.New("fixed must be like 16.16 with a multiple of 8 bits up to 64, got " + v)
+
+	i, f, ok := strings.Cut(strings.TrimSpace(v), ".")
+	if !ok {
+		return 0, 0, invalid
+	}
+
+	intBits, err := strconv.Atoi(i)
+	if err != nil || intBits < 0 {
+		return 0, 0, invalid
+	}
+
+	fracBits, err := strconv.Atoi(f)
+	if err != nil || fracBits < 0 {
+		return 0, 0, invalid
+	}
+
+	bits := intBits + fracBits
+	if bits == 0 || bits > 64 || bits%8 != 0 {
+		return 0, 0, invalid
+	}
+
+	return bits / 8, fracBits, nil
+}
+
+func parseRound(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if _, ok := roundFuncs[v]; !ok {
+		return "", errors.New("invalid round " + v + ", expected nearest, even, down, up or zero")
+	}
+	return v, nil
+}
+
+// scaled reports whether a float field is stored as an integer.
+func (d *fieldReadData) scaled() bool {
+	return d.Scale != 0 || d.Bias != 0 || d.Fixed != 0
+}
+
+// factor returns the value of one unit of the stored integer.
+func (d *fieldReadData) factor() float64 {
+	f := d.Scale
+	if f == 0 {
+		f = 1
+	}
+	return math.Ldexp(f, -d.FixedFrac)
+}
+
+// scaledWidth returns the number of bytes of the stored integer.
+func (d *fieldReadData) scaledWidth(fieldValue reflect.Value, length *int64) (int, error) {
+	if fieldValue.Kind() != reflect.Float32 && fieldValue.Kind() != reflect.Float64 {
+		return 0, errors.New(`scale, bias and fixed are not supported for type "` + fieldValue.Kind().String() + `"`)
+	}
+
+	if d.Fixed != 0 {
+		return d.Fixed, nil
+	}
+
+	if length == nil {
+		return 0, errors.New("need set tag with len or fixed for scale and bias")
+	}
+
+	if *length < 1 || *length > 8 {
+		return 0, fmt.Errorf("len of a scaled value must be between 1 and 8, got %d", *length)
+	}
+
+	return int(*length), nil
+}
+
+// readScaled decodes a float field stored as an integer: the value is the
+// integer times the scale plus the bias.
+func readScaled(r Reader, fieldValue reflect.Value, fieldData *fieldReadData, length *int64) error {
+	width, err := fieldData.scaledWidth(fieldValue, length)
+	if err != nil {
+		return err
+	}
+
+	var raw float64
+	if fieldData.Unsigned {
+		u, err := r.ReadUintX(width)
+		if err != nil {
+			return err
+		}
+		raw = float64(u)
+	} else {
+		i, err := r.ReadIntX(width)
+		if err != nil {
+			return err
+		}
+		raw = float64(i)
+	}
+
+	if fieldValue.CanSet() {
+		fieldValue.SetFloat(raw*fieldData.factor() + fieldData.Bias)
+	}
+	return nil
+}
+
+// writeScaled encodes a float field as the integer readScaled decodes it
+// from, rounded with the round tag. Values out of range of the integer are
+// an error.
+func writeScaled(w Writer, fieldValue reflect.Value, fieldData *fieldReadData, length *int64) error {
+	width, err := fieldData.scaledWidth(fieldValue, length)
+	if err != nil {
+		return err
+	}
+
+	v := fieldValue.Float()
+	round := roundFuncs[fieldData.Round]
+	if round == nil {
+		round = math.Round
+	}
+	raw := round((v - fieldData.Bias) / fieldData.factor())
+
+	bits := 8 * width
+	min, max := -math.Ldexp(1, bits-1), math.Ldexp(1, bits-1)
+	if fieldData.Unsigned {
+		min, max = 0, math.Ldexp(1, bits)
+	}
+
+	if math.IsNaN(raw) || raw < min || raw >= max {
+		return fmt.Errorf("value %g is out of range for %d bytes", v, width)
+	}
+
+	if fieldData.Unsigned {
+		return w.WriteUintX(uint64(raw), width)
+	}
+	return w.WriteIntX(int64(raw), width)
+}
@@ -0,0 +1,221 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// sectionReader limits reads and seeks to size bytes starting at the
+// current offset of r. Offsets are relative to the start of the section.
+type sectionReader struct {
+	r     io.ReadSeeker
+	start int64
+	size  int64
+	pos   int64
+}
+
+func (s *sectionReader) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+
+	if max := s.size - s.pos; int64(len(p)) > max {
+		p = p[:max]
+	}
+
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *sectionReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("binstruct: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("binstruct: negative position")
+	}
+
+	_, err := s.r.Seek(s.start+offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	s.pos = offset
+	return offset, nil
+}
+
+// section returns a Reader over the next size bytes of r.
+func section(r Reader, size int64) (*reader, *sectionReader, error) {
+	parent, ok := r.(*reader)
+	if !ok {
+		return nil, nil, fmt.Errorf("size tag is not supported by %T", r)
+	}
+
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := &sectionReader{r: r, start: start, size: size}
+	return &reader{
+		r:        s,
+		order:    parent.order,
+		bitOrder: parent.bitOrder,
+		bits:     &bitState{}, // the section starts at a byte boundary
+		nest:     parent.nest,
+		debug:    parent.debug,
+	}, s, nil
+}
+
+// evalSize returns the value of the size tag.
+func (d *fieldReadData) evalSize(env exprEnv) (int64, error) {
+	size, err := d.Size.eval(env)
+	if err != nil {
+		return 0, fmt.Errorf("eval size: %w", err)
+	}
+
+	if size < 0 {
+		return 0, fmt.Errorf("negative size %d", size)
+	}
+
+	return size, nil
+}
+
+// readSized decodes the field from a section of the input that is as long
+// as its size tag. Bytes the field does not read are an error unless
+// skipRest is set.
+func (u *unmarshal) readSized(r Reader, env exprEnv, structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
+	size, err := fieldData.evalSize(env)
+	if err != nil {
+		return err
+	}
+
+	sr, s, err := section(r, size)
+	if err != nil {
+		return err
+	}
+
+	sub := &unmarshal{r: sr, nest: u.nest}
+	err = sub.setValueToField(structValue, fieldValue, fieldData.Sized, parentStructValues)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("field overruns its size of %d bytes: %w", size, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.pos < size {
+		if !fieldData.SkipRest {
+			return fmt.Errorf("field read %d of its %d bytes", s.pos, size)
+		}
+
+		_, err = r.Seek(s.start+size, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSized encodes the field and checks that it fits its size tag.
+// A shorter field is padded with the fill byte if skipRest is set.
+func (m *marshal) writeSized(w Writer, env exprEnv, structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
+	size, err := fieldData.evalSize(env)
+	if err != nil {
+		return err
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	start := len(w.Bytes())
+
+	sub := &marshal{w: w, base: start, nest: m.nest}
+	err = sub.setValueToField(structValue, fieldValue, fieldData.Sized, parentStructValues)
+	if err != nil {
+		return err
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	n := int64(len(w.Bytes()) - start)
+	switch {
+	case n > size:
+		return fmt.Errorf("field encodes to %d bytes, more than its size of %d", n, size)
+	case n < size && !fieldData.SkipRest:
+		return fmt.Errorf("field encodes to %d bytes, less than its size of %d", n, size)
+	case n < size:
+		err = m.writeFill(size-n, fieldData.Fill)
+	}
+
+	return err
+}
+
+// fillSizeOf returns a copy of the struct with every field tagged with
+// sizeOf set to the encoded length of the field it names.
+func (m *marshal) fillSizeOf(p *structPlan, structValue reflect.Value, parentStructValues []reflect.Value) (reflect.Value, error) {
+	cp := reflect.New(structValue.Type()).Elem()
+	cp.Set(structValue)
+
+	for _, f := range p.fields {
+		if f.sizeOf == nil {
+			continue
+		}
+
+		target := f.sizeOf
+		data := target.data
+		if data.Sized != nil {
+			data = data.Sized
+		}
+
+		n, err := m.getValueLength(cp, cp.Field(target.index), data, parentStructValues)
+		if err != nil {
+			return cp, fieldError(err, `failed calc size of field "%s"`, target.name)
+		}
+
+		err = setSizeValue(cp.Field(f.index), int64(n))
+		if err != nil {
+			return cp, fmt.Errorf(`failed set value to field "%s": %w`, f.name, err)
+		}
+	}
+
+	return cp, nil
+}
+
+func setSizeValue(v reflect.Value, n int64) error {
+	if !v.CanSet() {
+		return errors.New("sizeOf field must be exported")
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(n) {
+			return fmt.Errorf("size %d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.OverflowUint(uint64(n)) {
+			return fmt.Errorf("size %d overflows %s", n, v.Type())
+		}
+		v.SetUint(uint64(n))
+	default:
+		return errors.New(`type "` + v.Kind().String() + `" not supported for sizeOf`)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package binstruct
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// trimFill strips the trailing code units of a fixed-length string that
+// consist of fill bytes only.
+func trimFill(b []byte, fill byte, unit int) []byte {
+	for len(b) >= unit && len(b)%unit == 0 && allFill(b[len(b)-unit:], fill) {
+		b = b[:len(b)-unit]
+	}
+	return b
+}
+
+func allFill(b []byte, fill byte) bool {
+	for _, c := range b {
+		if c != fill {
+			return false
+		}
+	}
+	return true
+}
+
+// fixedString returns s encoded as exactly n bytes, padded with the fill
+// byte. A longer string is an error unless truncate is set; it is then cut
+// at a character boundary.
+func fixedString(s string, n int64, fieldData *fieldReadData, enc *textEncoding) ([]byte, error) {
+	err := checkUnits(n, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := enc.encodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) > n {
+		if !fieldData.Truncate {
+			return nil, fmt.Errorf("string length %d is more than len %d", len(b), n)
+		}
+
+		b, err = truncateString(s, b, int(n), enc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return append(b, bytes.Repeat([]byte{fieldData.Fill}, int(n)-len(b))...), nil
+}
+
+func truncateString(s string, b []byte, n int, enc *textEncoding) ([]byte, error) {
+	if enc == nil {
+		i := n
+		for i > 0 && !utf8.RuneStart(b[i]) {
+			i--
+		}
+		return b[:i], nil
+	}
+
+	// Encoded lengths of characters vary, drop them until the rest fits
+	r := []rune(s)
+	for len(b) > n {
+		r = r[:len(r)-1]
+
+		var err error
+		b, err = enc.encodeString(string(r))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
@@ -2,11 +2,13 @@ package binstruct
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
-	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -22,12 +24,83 @@ const (
 	tagTypeOrderLE = "le"
 	tagTypeOrderBE = "be"
 
+	tagTypeBitOrderMSB = "msb"
+	tagTypeBitOrderLSB = "lsb"
+
 	tagTypeLength            = "len"
 	tagTypeOffsetFromCurrent = "offset"
 	tagTypeOffsetFromStart   = "offsetStart"
 	tagTypeOffsetFromEnd     = "offsetEnd"
+
+	tagTypeIf     = "if"
+	tagTypeSwitch = "switch"
+	tagTypeMagic  = "magic"
+	tagTypeConst  = "const" // alias of magic
+	tagTypeBits   = "bits"
+
+	tagTypeCString       = "cstring" // term:0x00
+	tagTypeTerminator    = "term"
+	tagTypeTermInclude   = "termInclude"
+	tagTypeTermNoConsume = "termNoConsume"
+	tagTypeMaxLength     = "maxLen"
+	tagTypePrefix        = "prefix"
+	tagTypeGreedy        = "greedy" // len:*
+	tagTypeUntil         = "until"
+	tagTypeUntilExclude  = "untilExclude"
+	tagTypeSize          = "size"
+	tagTypeSizeOf        = "sizeOf"
+	tagTypeSkipRest      = "skipRest"
+	tagTypeAlign         = "align"
+	tagTypeAlignStruct   = "alignStruct"
+	tagTypePad           = "pad"
+	tagTypePadTo         = "padTo"
+	tagTypeFill          = "fill"
+	tagTypeTrim          = "trim"
+	tagTypeTruncate      = "truncate"
+	tagTypeEncoding      = "enc"
+	tagTypeOptional      = "optional"
+	tagTypeVarint        = "varint"
+	tagTypeZigZag        = "zigzag" // varint of a zigzag encoded signed integer
+	tagTypeBCD           = "bcd"    // bcd:packed or bcd:unpacked
+	tagTypeScale         = "scale"
+	tagTypeBias          = "bias"
+	tagTypeFixed         = "fixed"
+	tagTypeUnsigned      = "unsigned"
+	tagTypeRound         = "round"
+	tagTypeFloat16       = float16Half
+	tagTypeBFloat16      = float16BFloat
+	tagTypeSigned        = "signed"
+	tagTypeOrder         = "order" // order:ABCD, DCBA, CDAB or BADC
+	tagTypeTime          = "time"
+	tagTypeTimeZone      = "tz"
+	tagTypeKey           = "key"
+	tagTypeValue         = "val"
 )
 
+// flagTags are the tags written without a value.
+var flagTags = map[string]bool{
+	tagTypeOrderLE:       true,
+	tagTypeOrderBE:       true,
+	tagTypeBitOrderMSB:   true,
+	tagTypeBitOrderLSB:   true,
+	tagTypeCString:       true,
+	tagTypeTermInclude:   true,
+	tagTypeTermNoConsume: true,
+	tagTypeGreedy:        true,
+	tagTypeUntilExclude:  true,
+	tagTypeSkipRest:      true,
+	tagTypeTrim:          true,
+	tagTypeTruncate:      true,
+	tagTypeOptional:      true,
+	tagTypeVarint:        true,
+	tagTypeZigZag:        true,
+	tagTypeBCD:           true,
+	tagTypeUnsigned:      true,
+	tagTypeFloat16:       true,
+	tagTypeBFloat16:      true,
+	tagTypeSigned:        true,
+}
+
 type tag struct {
 	Type  string
 	Value string
@@ -60,47 +133,29 @@ func parseTag(t string) ([]tag, error) {
 			tags = append(tags, tag{Type: tagTypeIgnore})
 
 		case strings.HasPrefix(v, "["):
-			v = v + "," + t
-			var arrBalance int
-			var closeIndex int
-			for {
-				in := v[closeIndex:]
-				idx := strings.IndexAny(in, "[]")
-				closeIndex += idx
-
-				if idx == -1 {
-					return nil, errors.New("unbalanced square bracket")
-				}
-
-				switch in[idx] {
-				case '[':
-					arrBalance--
-				case ']':
-					arrBalance++
-				}
-
-				closeIndex++
-
-				if arrBalance == 0 {
-					break
-				}
+			var pt []tag
+			var err error
+			pt, t, err = parseElemTags(v, t)
+			if err != nil {
+				return nil, err
 			}
 
-			t = v[closeIndex:]
-			v = v[1 : closeIndex-1]
+			tags = append(tags, tag{Type: tagTypeElement, ElemTags: pt})
+
+		case strings.HasPrefix(v, tagTypeKey+":["), strings.HasPrefix(v, tagTypeValue+":["):
+			typ := v[:strings.Index(v, ":")]
 
-			pt, err := parseTag(v)
+			var pt []tag
+			var err error
+			pt, t, err = parseElemTags(v[len(typ)+1:], t)
 			if err != nil {
 				return nil, err
 			}
 
-			tags = append(tags, tag{Type: tagTypeElement, ElemTags: pt})
-
-		case v == tagTypeOrderLE:
-			tags = append(tags, tag{Type: tagTypeOrderLE})
+			tags = append(tags, tag{Type: typ, ElemTags: pt})
 
-		case v == tagTypeOrderBE:
-			tags = append(tags, tag{Type: tagTypeOrderBE})
+		case flagTags[v]:
+			tags = append(tags, tag{Type: v})
 
 		default:
 			ts := strings.Split(v, ":")
@@ -124,94 +179,177 @@ func parseTag(t string) ([]tag, error) {
 	}
 }
 
+// parseElemTags parses the bracketed tags that v starts with. The brackets
+// may contain commas, so the rest of the tag t is taken into account; the
+// part of t after the closing bracket is returned.
+func parseElemTags(v, t string) ([]tag, string, error) {
+	v = v + "," + t
+	var arrBalance int
+	var closeIndex int
+	for {
+		in := v[closeIndex:]
+		idx := strings.IndexAny(in, "[]")
+		closeIndex += idx
+
+		if idx == -1 {
+			return nil, "", errors.New("unbalanced square bracket")
+		}
+
+		switch in[idx] {
+		case '[':
+			arrBalance--
+		case ']':
+			arrBalance++
+		}
+
+		closeIndex++
+
+		if arrBalance == 0 {
+			break
+		}
+	}
+
+	t = v[closeIndex:]
+	v = v[1 : closeIndex-1]
+
+	pt, err := parseTag(v)
+	if err != nil {
+		return nil, "", err
+	}
+	return pt, t, nil
+}
+
+// expr is a tag value that may depend on other fields. It is kept
+// unevaluated in the compiled plan and resolved against the struct
+// being processed every time the field is read or written.
+type expr interface {
+	eval(env exprEnv) (int64, error)
+}
+
 type fieldOffset struct {
-	Offset int64
+	Offset expr
 	Whence int
 }
 
 type fieldReadData struct {
-	Ignore   bool
-	Length   *int64
-	Offsets  []fieldOffset
-	FuncName string
-	Order    binary.ByteOrder
+	Ignore      bool
+	If          expr
+	Switch      expr
+	Magic       []byte
+	Bits        int
+	BitOrder    BitOrder
+	HasBitOrder bool // BitOrder was set with msb or lsb
+	Length      expr
+	Offsets     []fieldOffset
+	FuncName    string
+	Order       binary.ByteOrder
+
+	Terminator    []byte
+	TermInclude   bool // the terminator is part of the value
+	TermNoConsume bool // the terminator is left for the next field
+	CString       bool // the terminator is a zero code unit
+	MaxLength     expr
+
+	Prefix string // width of the count before a string or slice
+	Greedy bool   // read until the end of input
+
+	Until        expr // slice ends with the element it matches
+	UntilExclude bool // the matching element is not part of the slice
+
+	Size     expr           // the field is read from a section of Size bytes
+	SkipRest bool           // bytes of the section the field does not use are skipped
+	Sized    *fieldReadData // the field data applied inside the section
+	SizeOf   string         // Marshal writes the encoded length of this field
+
+	Align       int  // the field starts at a multiple of Align
+	AlignStruct bool // Align is counted from the start of the struct
+	Pad         int  // bytes after the field
+	PadTo       int  // the field with Pad is a multiple of PadTo bytes
+	Fill        byte // Marshal writes padding with this byte
+
+	Trim     bool   // trailing fill bytes are stripped from a string with len
+	Truncate bool   // a string longer than len is cut instead of an error
+	Encoding string // character encoding of a string, see RegisterTextEncoding
+
+	Optional bool           // a presence byte tells whether a pointer is nil
+	Pointee  *fieldReadData // the field data applied to the value of an optional pointer
+
+	Varint bool // the integer is an unsigned LEB128 varint
+	ZigZag bool // the varint of a signed integer is zigzag encoded
+
+	BCD      bool // the number is stored as decimal digits
+	Unpacked bool // one BCD digit per byte instead of two
+
+	Scale     float64 // a float is stored as an integer times Scale plus Bias
+	Bias      float64
+	Fixed     int    // width in bytes of a Q format integer
+	FixedFrac int    // fraction bits of the Q format
+	Unsigned  bool   // the stored integer is unsigned
+	Round     string // rounding of Marshal, see roundFuncs
+
+	Float16 string // a float is stored in two bytes as f16 or bf16
+
+	Signed bool // a *big.Int or time:unix32 is two's complement
+
+	Time     string         // encoding of a time.Time or time.Duration
+	Location *time.Location // time zone of dos and bcd times, UTC by default
 
 	ElemFieldData *fieldReadData // if type Element
+	KeyFieldData  *fieldReadData // keys of a map
+	ValFieldData  *fieldReadData // values of a map
 }
 
-func parseCalc(v string) (nums, ops []string) {
-	cur := v
-	for {
-		idx := strings.IndexAny(cur, "+-/*")
-		if idx == -1 {
-			nums = append(nums, cur)
-			break
-		}
-
-		nums = append(nums, cur[:idx])
-		ops = append(ops, string(cur[idx]))
-
-		cur = cur[idx+1:]
+// parseHexBytes parses a hex byte string such as 0x89504E47.
+func parseHexBytes(name, v string) ([]byte, error) {
+	h := strings.TrimSpace(v)
+	if len(h) > 2 && (h[:2] == "0x" || h[:2] == "0X") {
+		h = h[2:]
 	}
 
-	return nums, ops
+	b, err := hex.DecodeString(h)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid " + name + " value " + v + ", expected hex bytes like 0x504B")
+	}
+	return b, nil
 }
 
-func parseValue(structValue reflect.Value, v string) (int64, error) {
-	v = strings.TrimSpace(v)
-	if v == "" {
-		return 0, nil
+func parsePositive(name, v string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 1 {
+		return 0, errors.New(name + " must be a positive number, got " + v)
 	}
+	return n, nil
+}
 
-	// calculate
-	mathIndex := strings.IndexAny(v, "+-/*")
-	if mathIndex != -1 {
-		nums, ops := parseCalc(v)
-
-		var result int64
-		for k := range nums {
-			n, err := parseValue(structValue, nums[k])
-			if err != nil {
-				return 0, err
-			}
+// skip reports whether the field is absent because its if tag is false.
+func (d *fieldReadData) skip(env exprEnv) (bool, error) {
+	if d.If == nil {
+		return false, nil
+	}
 
-			if k == 0 {
-				result = n
-				continue
-			}
+	cond, err := d.If.eval(env)
+	if err != nil {
+		return false, fmt.Errorf("eval if: %w", err)
+	}
 
-			switch ops[k-1] {
-			case "+":
-				result += n
-			case "-":
-				result -= n
-			case "/":
-				result /= n
-			case "*":
-				result *= n
-			}
-		}
+	return cond == 0, nil
+}
 
-		return result, nil
+// evalLength returns the value of the len tag, or nil if it is not set.
+func (d *fieldReadData) evalLength(env exprEnv) (*int64, error) {
+	if d.Length == nil {
+		return nil, nil
 	}
 
-	// parse value or get from field
-	l, err := strconv.ParseInt(v, 10, 0)
+	length, err := d.Length.eval(env)
 	if err != nil {
-		lenVal := structValue.FieldByName(v)
-		switch lenVal.Kind() {
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			l = lenVal.Int()
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-			l = int64(lenVal.Uint())
-		default:
-			return 0, errors.New("can't get field len from " + v + " field")
-		}
+		return nil, err
 	}
-	return l, nil
+
+	return &length, nil
 }
 
-func parseReadDataFromTags(structValue reflect.Value, tags []tag) (*fieldReadData, error) {
+func parseReadDataFromTags(tags []tag) (*fieldReadData, error) {
 	var data fieldReadData
 	var err error
 	for _, t := range tags {
@@ -220,45 +358,193 @@ func parseReadDataFromTags(structValue reflect.Value, tags []tag) (*fieldReadDat
 			return &fieldReadData{Ignore: true}, nil
 
 		case tagTypeLength:
-			var length int64
-			length, err = parseValue(structValue, t.Value)
-			data.Length = &length
+			if strings.TrimSpace(t.Value) == "*" {
+				data.Greedy = true
+				break
+			}
+			data.Length, err = parseExpr(t.Value)
 
 		case tagTypeOffsetFromCurrent:
-			var offset int64
-			offset, err = parseValue(structValue, t.Value)
+			var offset expr
+			offset, err = parseExpr(t.Value)
 			data.Offsets = append(data.Offsets, fieldOffset{
 				Offset: offset,
 				Whence: io.SeekCurrent,
 			})
 
 		case tagTypeOffsetFromStart:
-			var offset int64
-			offset, err = parseValue(structValue, t.Value)
+			var offset expr
+			offset, err = parseExpr(t.Value)
 			data.Offsets = append(data.Offsets, fieldOffset{
 				Offset: offset,
 				Whence: io.SeekStart,
 			})
 
 		case tagTypeOffsetFromEnd:
-			var offset int64
-			offset, err = parseValue(structValue, t.Value)
+			var offset expr
+			offset, err = parseExpr(t.Value)
 			data.Offsets = append(data.Offsets, fieldOffset{
 				Offset: offset,
 				Whence: io.SeekEnd,
 			})
 
+		case tagTypeIf:
+			data.If, err = parseExpr(t.Value)
+
+		case tagTypeSwitch:
+			data.Switch, err = parseExpr(t.Value)
+
+		case tagTypeMagic, tagTypeConst:
+			data.Magic, err = parseHexBytes("magic", t.Value)
+
+		case tagTypeCString:
+			data.Terminator = []byte{0x00}
+			data.CString = true
+
+		case tagTypeTerminator:
+			data.Terminator, err = parseHexBytes("term", t.Value)
+			data.CString = false
+
+		case tagTypeTermInclude:
+			data.TermInclude = true
+
+		case tagTypeTermNoConsume:
+			data.TermNoConsume = true
+
+		case tagTypeMaxLength:
+			data.MaxLength, err = parseExpr(t.Value)
+
+		case tagTypePrefix:
+			data.Prefix, err = parsePrefix(t.Value)
+
+		case tagTypeGreedy:
+			data.Greedy = true
+
+		case tagTypeUntil:
+			data.Until, err = parseExpr(t.Value)
+
+		case tagTypeUntilExclude:
+			data.UntilExclude = true
+
+		case tagTypeSize:
+			data.Size, err = parseExpr(t.Value)
+
+		case tagTypeSkipRest:
+			data.SkipRest = true
+
+		case tagTypeSizeOf:
+			data.SizeOf = strings.TrimSpace(t.Value)
+
+		case tagTypeAlign:
+			data.Align, err = parsePositive(t.Type, t.Value)
+
+		case tagTypeAlignStruct:
+			data.Align, err = parsePositive(t.Type, t.Value)
+			data.AlignStruct = true
+
+		case tagTypePad:
+			data.Pad, err = parsePositive(t.Type, t.Value)
+			if err != nil && strings.HasPrefix(strings.TrimSpace(t.Value), "0x") {
+				err = errors.New("pad is a number of bytes after the field, got " + t.Value + ", set the fill byte of a string with fill")
+			}
+
+		case tagTypePadTo:
+			data.PadTo, err = parsePositive(t.Type, t.Value)
+
+		case tagTypeTrim:
+			data.Trim = true
+
+		case tagTypeTruncate:
+			data.Truncate = true
+
+		case tagTypeEncoding:
+			data.Encoding = strings.TrimSpace(t.Value)
+
+		case tagTypeOptional:
+			data.Optional = true
+
+		case tagTypeVarint:
+			data.Varint = true
+
+		case tagTypeZigZag:
+			data.Varint = true
+			data.ZigZag = true
+
+		case tagTypeBCD:
+			data.BCD = true
+			data.Unpacked, err = parseBCD(t.Value)
+
+		case tagTypeScale:
+			data.Scale, err = parseScale(t.Value)
+
+		case tagTypeBias:
+			data.Bias, err = parseBias(t.Value)
+
+		case tagTypeFixed:
+			data.Fixed, data.FixedFrac, err = parseFixed(t.Value)
+
+		case tagTypeUnsigned:
+			data.Unsigned = true
+
+		case tagTypeRound:
+			data.Round, err = parseRound(t.Value)
+
+		case tagTypeFloat16, tagTypeBFloat16:
+			data.Float16 = t.Type
+
+		case tagTypeSigned:
+			data.Signed = true
+
+		case tagTypeTime:
+			data.Time, err = parseTime(t.Value)
+
+		case tagTypeTimeZone:
+			data.Location, err = parseLocation(t.Value)
+
+		case tagTypeFill:
+			var fill []byte
+			fill, err = parseHexBytes("fill", t.Value)
+			if err == nil && len(fill) != 1 {
+				err = errors.New("fill must be one byte, got " + t.Value)
+			}
+			if err == nil {
+				data.Fill = fill[0]
+			}
+
+		case tagTypeBits:
+			data.Bits, err = strconv.Atoi(t.Value)
+			if err == nil && (data.Bits < 1 || data.Bits > 64) {
+				err = errors.New("bits must be between 1 and 64, got " + t.Value)
+			}
+
 		case tagTypeFunc:
 			data.FuncName = t.Value
 
 		case tagTypeElement:
-			data.ElemFieldData, err = parseReadDataFromTags(structValue, t.ElemTags)
+			data.ElemFieldData, err = parseReadDataFromTags(t.ElemTags)
+
+		case tagTypeKey:
+			data.KeyFieldData, err = parseReadDataFromTags(t.ElemTags)
+
+		case tagTypeValue:
+			data.ValFieldData, err = parseReadDataFromTags(t.ElemTags)
 
 		case tagTypeOrderLE:
 			data.Order = binary.LittleEndian
 
+		case tagTypeOrder:
+			data.Order, err = parseOrder(t.Value)
+
 		case tagTypeOrderBE:
 			data.Order = binary.BigEndian
+
+		case tagTypeBitOrderMSB:
+			data.BitOrder = MSBFirst
+			data.HasBitOrder = true
+
+		case tagTypeBitOrderLSB:
+			data.BitOrder = LSBFirst
+			data.HasBitOrder = true
 		}
 
 		if err != nil {
@@ -266,5 +552,66 @@ func parseReadDataFromTags(structValue reflect.Value, tags []tag) (*fieldReadDat
 		}
 	}
 
+	if data.Prefix != "" && (data.Length != nil || data.Terminator != nil) {
+		return nil, errors.New("prefix can't be used with len or term")
+	}
+
+	if data.Greedy && (data.Length != nil || data.Terminator != nil || data.Prefix != "") {
+		return nil, errors.New("greedy can't be used with len, term or prefix")
+	}
+
+	if data.Until != nil && (data.Length != nil || data.Terminator != nil || data.Prefix != "" || data.Greedy) {
+		return nil, errors.New("until can't be used with len, term, prefix or greedy")
+	}
+
+	if data.Varint && (data.Length != nil || data.Bits != 0) {
+		return nil, errors.New("varint can't be used with len or bits")
+	}
+
+	if data.BCD && (data.Prefix != "" || data.Terminator != nil || data.Greedy || data.Varint) {
+		return nil, errors.New("bcd can't be used with prefix, term, greedy or varint")
+	}
+
+	if data.Fixed != 0 && data.Length != nil {
+		return nil, errors.New("fixed can't be used with len")
+	}
+
+	if data.scaled() && (data.Varint || data.BCD) {
+		return nil, errors.New("scale, bias and fixed can't be used with varint or bcd")
+	}
+
+	if data.Float16 != "" && (data.Length != nil || data.scaled()) {
+		return nil, errors.New(data.Float16 + " can't be used with len, scale, bias or fixed")
+	}
+
+	if data.Time != "" && (data.Varint || data.BCD || data.scaled() || data.Float16 != "") {
+		return nil, errors.New("time can't be used with varint, bcd, scale, bias, fixed or f16")
+	}
+
+	// Slices and arrays of a union share the discriminator of the field
+	if data.Switch != nil {
+		if data.ElemFieldData == nil {
+			data.ElemFieldData = &fieldReadData{}
+		}
+		if data.ElemFieldData.Switch == nil {
+			data.ElemFieldData.Switch = data.Switch
+		}
+	}
+
+	if data.Size != nil {
+		// Offsets are applied before the section starts
+		sized := data
+		sized.Size = nil
+		sized.SkipRest = false
+		sized.Offsets = nil
+		data.Sized = &sized
+	}
+
+	if data.Optional {
+		pointee := data
+		pointee.Optional = false
+		data.Pointee = &pointee
+	}
+
 	return &data, nil
 }
@@ -34,6 +34,35 @@ func Test_parseTag(t *testing.T) {
 			tag:  "be",
 			want: []tag{{Type: "be"}},
 		},
+		{
+			name: "cstring",
+			tag:  "cstring,maxLen:16",
+			want: []tag{{Type: "cstring"}, {Type: "maxLen", Value: "16"}},
+		},
+		{
+			name: "prefix",
+			tag:  "prefix:varint",
+			want: []tag{{Type: "prefix", Value: "varint"}},
+		},
+		{
+			name: "greedy",
+			tag:  "greedy",
+			want: []tag{{Type: "greedy"}},
+		},
+		{
+			name: "term",
+			tag:  "term:0x0A,termInclude,termNoConsume",
+			want: []tag{{Type: "term", Value: "0x0A"}, {Type: "termInclude"}, {Type: "termNoConsume"}},
+		},
+		{
+			name: "map",
+			tag:  "len:2,key:[len:4,le],val:[prefix:u8]",
+			want: []tag{
+				{Type: "len", Value: "2"},
+				{Type: "key", ElemTags: []tag{{Type: "len", Value: "4"}, {Type: "le"}}},
+				{Type: "val", ElemTags: []tag{{Type: "prefix", Value: "u8"}}},
+			},
+		},
 		{
 			name: "func",
 			tag:  "TestFunc",
@@ -133,9 +162,10 @@ func Test_parseReadDataFromTags(t *testing.T) {
 		return &i
 	}
 	tests := []struct {
-		name string
-		args args
-		want *fieldReadData
+		name        string
+		args        args
+		wantLength  *int64
+		wantOffsets []int64
 	}{
 		{
 			name: "calc len 5+2",
@@ -148,9 +178,7 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Length: ptrInt(7),
-			},
+			wantLength: ptrInt(7),
 		},
 		{
 			name: "calc len 1-2",
@@ -163,9 +191,7 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Length: ptrInt(3),
-			},
+			wantLength: ptrInt(3),
 		},
 		{
 			name: "calc len 5*2",
@@ -178,9 +204,7 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Length: ptrInt(10),
-			},
+			wantLength: ptrInt(10),
 		},
 		{
 			name: "calc len 10/2",
@@ -193,9 +217,7 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Length: ptrInt(5),
-			},
+			wantLength: ptrInt(5),
 		},
 		{
 			name: "calc len 5+FieldValue",
@@ -212,9 +234,7 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Length: ptrInt(7),
-			},
+			wantLength: ptrInt(7),
 		},
 		{
 			name: "calc len 5-FieldValue",
@@ -231,12 +251,10 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Length: ptrInt(3),
-			},
+			wantLength: ptrInt(3),
 		},
 		{
-			name: "calc len many 10 + FieldAdd + 10 - 5 - FieldSub / 2",
+			name: "calc len many 10 + FieldAdd + 10 - 5 - FieldSub / 2 with precedence",
 			args: args{
 				structValue: reflect.ValueOf(struct {
 					FieldAdd int
@@ -252,9 +270,7 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Length: ptrInt(5),
-			},
+			wantLength: ptrInt(15),
 		},
 		{
 			name: "calc offset -10",
@@ -267,14 +283,7 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Offsets: []fieldOffset{
-					{
-						Offset: -10,
-						Whence: 1,
-					},
-				},
-			},
+			wantOffsets: []int64{-10},
 		},
 		{
 			name: "calc offset -10 + -5",
@@ -287,14 +296,7 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Offsets: []fieldOffset{
-					{
-						Offset: -15,
-						Whence: 1,
-					},
-				},
-			},
+			wantOffsets: []int64{-15},
 		},
 		{
 			name: "calc offset -10 + -5 + 5",
@@ -307,21 +309,25 @@ func Test_parseReadDataFromTags(t *testing.T) {
 					},
 				},
 			},
-			want: &fieldReadData{
-				Offsets: []fieldOffset{
-					{
-						Offset: -10,
-						Whence: 1,
-					},
-				},
-			},
+			wantOffsets: []int64{-10},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseReadDataFromTags(tt.args.structValue, tt.args.tags)
+			got, err := parseReadDataFromTags(tt.args.tags)
 			require.NoError(t, err)
-			require.Equal(t, tt.want, got)
+
+			length, err := got.evalLength(exprEnv{structValue: tt.args.structValue})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantLength, length)
+
+			var offsets []int64
+			for _, o := range got.Offsets {
+				offset, err := o.Offset.eval(exprEnv{structValue: tt.args.structValue})
+				require.NoError(t, err)
+				offsets = append(offsets, offset)
+			}
+			require.Equal(t, tt.wantOffsets, offsets)
 		})
 	}
 }
@@ -0,0 +1,153 @@
+package binstruct
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// TerminatorNotFoundError is returned when a terminated string or byte
+// slice is longer than its maxLen tag allows.
+type TerminatorNotFoundError struct {
+	Terminator []byte
+	MaxLength  int64
+}
+
+func (e *TerminatorNotFoundError) Error() string {
+	return fmt.Sprintf("binstruct: terminator %#x not found within %d bytes", e.Terminator, e.MaxLength)
+}
+
+// evalMaxLength returns the value of the maxLen tag, or -1 if it is not set.
+func (d *fieldReadData) evalMaxLength(env exprEnv) (int64, error) {
+	if d.MaxLength == nil {
+		return -1, nil
+	}
+
+	max, err := d.MaxLength.eval(env)
+	if err != nil {
+		return 0, fmt.Errorf("eval maxLen: %w", err)
+	}
+
+	return max, nil
+}
+
+// terminator returns the terminator of the field for text with code
+// units of unit bytes. A cstring ends with a zero code unit.
+func (d *fieldReadData) terminator(unit int) []byte {
+	if d.CString {
+		return make([]byte, unit)
+	}
+	return d.Terminator
+}
+
+// indexTerminator returns the index of the first terminator in b that
+// starts at a code unit boundary, or -1.
+func indexTerminator(b, term []byte, unit int) int {
+	for i := 0; i+len(term) <= len(b); i += unit {
+		if bytes.HasPrefix(b[i:], term) {
+			return i
+		}
+	}
+	return -1
+}
+
+// readTerminated reads bytes up to and including the terminator of the
+// field. The terminator is stripped unless termInclude is set and is
+// unread again if termNoConsume is set.
+func readTerminated(r Reader, env exprEnv, fieldData *fieldReadData, unit int) ([]byte, error) {
+	max, err := fieldData.evalMaxLength(env)
+	if err != nil {
+		return nil, err
+	}
+
+	term := fieldData.terminator(unit)
+	var b []byte
+	for len(b)%unit != 0 || !bytes.HasSuffix(b, term) {
+		if max >= 0 && int64(len(b)) >= max+int64(len(term)) {
+			return nil, &TerminatorNotFoundError{Terminator: term, MaxLength: max}
+		}
+
+		c, err := r.ReadByte()
+		if err != nil {
+			if len(b) > 0 && errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		b = append(b, c)
+	}
+
+	if fieldData.TermNoConsume {
+		_, err = r.Seek(int64(-len(term)), io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !fieldData.TermInclude {
+		b = b[:len(b)-len(term)]
+	}
+
+	return b, nil
+}
+
+// terminatedValue returns the value of a terminated field without its
+// terminator and checks that it can be read back.
+func terminatedValue(env exprEnv, fieldData *fieldReadData, b []byte, unit int) ([]byte, error) {
+	term := fieldData.terminator(unit)
+	if fieldData.TermInclude && len(b)%unit == 0 {
+		b = bytes.TrimSuffix(b, term)
+	}
+
+	if indexTerminator(b, term, unit) >= 0 {
+		return nil, fmt.Errorf("value contains terminator %#x", term)
+	}
+
+	max, err := fieldData.evalMaxLength(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if max >= 0 && int64(len(b)) > max {
+		return nil, fmt.Errorf("value length %d is more than maxLen %d", len(b), max)
+	}
+
+	return b, nil
+}
+
+// writeTerminated writes b followed by the terminator of the field. The
+// terminator is not written if termNoConsume is set.
+func writeTerminated(w Writer, env exprEnv, fieldData *fieldReadData, b []byte, unit int) error {
+	b, err := terminatedValue(env, fieldData, b, unit)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	if err != nil {
+		return err
+	}
+
+	if fieldData.TermNoConsume {
+		return nil
+	}
+
+	_, err = w.Write(fieldData.terminator(unit))
+	return err
+}
+
+// terminatedLength returns the number of bytes writeTerminated writes.
+func terminatedLength(env exprEnv, fieldData *fieldReadData, b []byte, unit int) (int, error) {
+	b, err := terminatedValue(env, fieldData, b, unit)
+	if err != nil {
+		return 0, err
+	}
+
+	if fieldData.TermNoConsume {
+		return len(b), nil
+	}
+
+	return len(b) + len(fieldData.terminator(unit)), nil
+}
@@ -0,0 +1,399 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	timeUnix32   = "unix32"   // seconds since 1970 in 4 bytes, signed with the signed tag
+	timeUnix64   = "unix64"   // signed seconds since 1970 in 8 bytes
+	timeUnixMs   = "unixms"   // signed milliseconds since 1970 in 8 bytes
+	timeFileTime = "filetime" // 100 ns intervals since 1601 in 8 bytes (Windows FILETIME)
+	timeDOS      = "dos"      // MS-DOS time then date, 2 bytes each (FAT, ZIP)
+	timeGPS      = "gps"      // GPS week in 2 bytes then seconds of the week in 4 bytes
+	timeBCD      = "bcd"      // YYMMDDhhmmss in 6 bytes of BCD, or YYYYMMDDhhmmss with len:7
+)
+
+// timeSizes maps the values of the time tag to their size in bytes.
+var timeSizes = map[string]int{
+	timeUnix32:   4,
+	timeUnix64:   8,
+	timeUnixMs:   8,
+	timeFileTime: 8,
+	timeDOS:      4,
+	timeGPS:      6,
+	timeBCD:      6,
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+
+	// gpsEpoch is the start of GPS week 0. GPS time has no leap seconds and
+	// is ahead of UTC by those since 1980 (18 s since 2017). The gps tag
+	// does not apply them: the time.Time holds the GPS time as if it were
+	// UTC, callers subtract the offset of their receiver to get UTC.
+	gpsEpoch = time.Date(1980, time.January, 6, 0, 0, 0, 0, time.UTC)
+)
+
+// fileTimeOffset is the number of seconds from 1601 to 1970.
+const fileTimeOffset = 11644473600
+
+func parseTime(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if _, ok := timeSizes[v]; !ok {
+		return "", errors.New("invalid time " + v + ", expected unix32, unix64, unixms, filetime, dos, gps or bcd")
+	}
+	return v, nil
+}
+
+// parseLocation parses the tz tag: UTC, Local, an IANA name such as
+// Europe/Berlin or a fixed offset such as +0800.
+func parseLocation(v string) (*time.Location, error) {
+	v = strings.TrimSpace(v)
+	if len(v) == 5 && (v[0] == '+' || v[0] == '-') {
+		h, errH := strconv.Atoi(v[1:3])
+		m, errM := strconv.Atoi(v[3:])
+		if errH != nil || errM != nil || h > 23 || m > 59 {
+			return nil, errors.New("invalid tz offset " + v + ", expected like +0800")
+		}
+
+		offset := h*3600 + m*60
+		if v[0] == '-' {
+			offset = -offset
+		}
+		return time.FixedZone(v, offset), nil
+	}
+
+	loc, err := time.LoadLocation(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz %s: %w", v, err)
+	}
+	return loc, nil
+}
+
+// location returns the time zone of a time field, UTC by default.
+func (d *fieldReadData) location() *time.Location {
+	if d.Location == nil {
+		return time.UTC
+	}
+	return d.Location
+}
+
+// timeSize returns the number of bytes of a time field.
+func timeSize(fieldValue reflect.Value, fieldData *fieldReadData, length *int64) (int, error) {
+	switch fieldValue.Type() {
+	case timeType:
+	case durationType:
+		switch fieldData.Time {
+		case timeDOS, timeGPS, timeBCD:
+			return 0, errors.New("time:" + fieldData.Time + " is not supported for time.Duration")
+		}
+	default:
+		return 0, errors.New(`time is not supported for type "` + fieldValue.Type().String() + `"`)
+	}
+
+	if length == nil {
+		return timeSizes[fieldData.Time], nil
+	}
+
+	if fieldData.Time == timeBCD && (*length == 6 || *length == 7) {
+		return int(*length), nil
+	}
+	return 0, fmt.Errorf("len %d can't be used with time:%s", *length, fieldData.Time)
+}
+
+// readTime decodes a time.Time or time.Duration field. A duration uses
+// the unit and width of the encoding, seconds for unix32 for example.
+func readTime(r Reader, fieldValue reflect.Value, fieldData *fieldReadData, length *int64) error {
+	n, err := timeSize(fieldValue, fieldData, length)
+	if err != nil {
+		return err
+	}
+
+	var value reflect.Value
+	if fieldValue.Type() == durationType {
+		var d time.Duration
+		d, err = readDuration(r, fieldData)
+		value = reflect.ValueOf(d)
+	} else {
+		var t time.Time
+		t, err = readTimeValue(r, fieldData, n)
+		value = reflect.ValueOf(t)
+	}
+	if err != nil {
+		return err
+	}
+
+	if fieldValue.CanSet() {
+		fieldValue.Set(value)
+	}
+	return nil
+}
+
+func readUnixSeconds(r Reader, fieldData *fieldReadData) (int64, error) {
+	switch fieldData.Time {
+	case timeUnix32:
+		if fieldData.Signed {
+			s, err := r.ReadInt32()
+			return int64(s), err
+		}
+		s, err := r.ReadUint32()
+		return int64(s), err
+	default:
+		return r.ReadInt64()
+	}
+}
+
+func readDuration(r Reader, fieldData *fieldReadData) (time.Duration, error) {
+	switch fieldData.Time {
+	case timeUnixMs:
+		ms, err := r.ReadInt64()
+		if err != nil {
+			return 0, err
+		}
+		return checkedDuration(ms, time.Millisecond)
+	case timeFileTime:
+		ticks, err := r.ReadUint64()
+		if err != nil {
+			return 0, err
+		}
+		if ticks > math.MaxInt64/100 {
+			return 0, fmt.Errorf("duration of %d ticks overflows time.Duration", ticks)
+		}
+		return time.Duration(ticks) * 100, nil
+	default:
+		s, err := readUnixSeconds(r, fieldData)
+		if err != nil {
+			return 0, err
+		}
+		return checkedDuration(s, time.Second)
+	}
+}
+
+func checkedDuration(n int64, unit time.Duration) (time.Duration, error) {
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return 0, fmt.Errorf("duration of %d x %v overflows time.Duration", n, unit)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func readTimeValue(r Reader, fieldData *fieldReadData, n int) (time.Time, error) {
+	loc := fieldData.location()
+
+	switch fieldData.Time {
+	case timeUnixMs:
+		ms, err := r.ReadInt64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(ms).In(loc), nil
+	case timeFileTime:
+		ticks, err := r.ReadUint64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		s := int64(ticks/1e7) - fileTimeOffset
+		return time.Unix(s, int64(ticks%1e7)*100).In(loc), nil
+	case timeDOS:
+		return readDOSTime(r, loc)
+	case timeGPS:
+		week, err := r.ReadUint16()
+		if err != nil {
+			return time.Time{}, err
+		}
+		s, err := r.ReadUint32()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return gpsEpoch.AddDate(0, 0, 7*int(week)).Add(time.Duration(s) * time.Second).In(loc), nil
+	case timeBCD:
+		return readBCDTime(r, loc, n)
+	default:
+		s, err := readUnixSeconds(r, fieldData)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(s, 0).In(loc), nil
+	}
+}
+
+// readDOSTime decodes an MS-DOS time and date. Both zero is the zero
+// time.Time, as written for files without a date.
+func readDOSTime(r Reader, loc *time.Location) (time.Time, error) {
+	tm, err := r.ReadUint16()
+	if err != nil {
+		return time.Time{}, err
+	}
+	dt, err := r.ReadUint16()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if tm == 0 && dt == 0 {
+		return time.Time{}, nil
+	}
+
+	return checkedDate(1980+int(dt>>9), int(dt>>5&0x0F), int(dt&0x1F), int(tm>>11), int(tm>>5&0x3F), int(tm&0x1F)*2, loc)
+}
+
+func readBCDTime(r Reader, loc *time.Location, n int) (time.Time, error) {
+	_, b, err := r.ReadBytes(n)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	v := make([]int, n)
+	for i, c := range b {
+		if c>>4 > 9 || c&0x0F > 9 {
+			return time.Time{}, fmt.Errorf("invalid bcd byte %#02x at index %d", c, i)
+		}
+		v[i] = int(c>>4)*10 + int(c&0x0F)
+	}
+
+	year := 2000 + v[0]
+	if n == 7 {
+		year = v[0]*100 + v[1]
+		v = v[1:]
+	}
+
+	return checkedDate(year, v[1], v[2], v[3], v[4], v[5], loc)
+}
+
+// checkedDate returns the time of the date fields, which time.Date would
+// otherwise normalize.
+func checkedDate(year, month, day, hour, min, sec int, loc *time.Location) (time.Time, error) {
+	t := time.Date(year, time.Month(month), day, hour, min, sec, 0, loc)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day || t.Hour() != hour || t.Minute() != min || t.Second() != sec {
+		return time.Time{}, fmt.Errorf("invalid date %04d-%02d-%02d %02d:%02d:%02d", year, month, day, hour, min, sec)
+	}
+	return t, nil
+}
+
+// writeTime encodes a time.Time or time.Duration field as readTime
+// decodes it. Times out of range of the encoding are an error.
+func writeTime(w Writer, fieldValue reflect.Value, fieldData *fieldReadData, length *int64) error {
+	n, err := timeSize(fieldValue, fieldData, length)
+	if err != nil {
+		return err
+	}
+
+	if fieldValue.Type() == durationType {
+		return writeDuration(w, fieldData, time.Duration(fieldValue.Int()))
+	}
+	return writeTimeValue(w, fieldData, fieldValue.Interface().(time.Time), n)
+}
+
+func writeUnixSeconds(w Writer, fieldData *fieldReadData, s int64) error {
+	if fieldData.Time != timeUnix32 {
+		return w.WriteInt64(s)
+	}
+
+	if fieldData.Signed {
+		if s < math.MinInt32 || s > math.MaxInt32 {
+			return fmt.Errorf("%d seconds are out of range for unix32", s)
+		}
+		return w.WriteInt32(int32(s))
+	}
+
+	if s < 0 || s > math.MaxUint32 {
+		return fmt.Errorf("%d seconds are out of range for unix32", s)
+	}
+	return w.WriteUint32(uint32(s))
+}
+
+func writeDuration(w Writer, fieldData *fieldReadData, d time.Duration) error {
+	switch fieldData.Time {
+	case timeUnixMs:
+		return w.WriteInt64(d.Milliseconds())
+	case timeFileTime:
+		if d < 0 {
+			return fmt.Errorf("negative duration %v can't be encoded as filetime", d)
+		}
+		return w.WriteUint64(uint64(d / 100))
+	default:
+		return writeUnixSeconds(w, fieldData, int64(d/time.Second))
+	}
+}
+
+func writeTimeValue(w Writer, fieldData *fieldReadData, t time.Time, n int) error {
+	t = t.In(fieldData.location())
+
+	switch fieldData.Time {
+	case timeUnixMs:
+		return w.WriteInt64(t.UnixMilli())
+	case timeFileTime:
+		s := t.Unix() + fileTimeOffset
+		if s < 0 || uint64(s) >= math.MaxUint64/10000000 {
+			return fmt.Errorf("time %v is out of range for filetime", t)
+		}
+		return w.WriteUint64(uint64(s)*1e7 + uint64(t.Nanosecond()/100))
+	case timeDOS:
+		return writeDOSTime(w, t)
+	case timeGPS:
+		if t.Before(gpsEpoch) {
+			return fmt.Errorf("time %v is before the gps epoch", t)
+		}
+
+		s := int64(t.Sub(gpsEpoch) / time.Second)
+		week := s / (7 * 24 * 3600)
+		if week > math.MaxUint16 {
+			return fmt.Errorf("time %v is out of range for gps", t)
+		}
+
+		err := w.WriteUint16(uint16(week))
+		if err != nil {
+			return err
+		}
+		return w.WriteUint32(uint32(s % (7 * 24 * 3600)))
+	case timeBCD:
+		return writeBCDTime(w, t, n)
+	default:
+		return writeUnixSeconds(w, fieldData, t.Unix())
+	}
+}
+
+// writeDOSTime encodes an MS-DOS time and date with 2 second resolution.
+func writeDOSTime(w Writer, t time.Time) error {
+	var tm, dt uint16
+	if !t.IsZero() {
+		if t.Year() < 1980 || t.Year() > 2107 {
+			return fmt.Errorf("time %v is out of range for dos", t)
+		}
+
+		tm = uint16(t.Hour()<<11 | t.Minute()<<5 | t.Second()/2)
+		dt = uint16((t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day())
+	}
+
+	err := w.WriteUint16(tm)
+	if err != nil {
+		return err
+	}
+	return w.WriteUint16(dt)
+}
+
+func writeBCDTime(w Writer, t time.Time, n int) error {
+	v := []int{t.Year() % 100, int(t.Month()), t.Day(), t.Hour(), t.Minute(), t.Second()}
+	if n == 7 {
+		if t.Year() < 0 || t.Year() > 9999 {
+			return fmt.Errorf("time %v is out of range for bcd", t)
+		}
+		v = append([]int{t.Year() / 100}, v...)
+	} else if t.Year() < 2000 || t.Year() > 2099 {
+		return fmt.Errorf("time %v is out of range for bcd, use len:7 for a four digit year", t)
+	}
+
+	b := make([]byte, len(v))
+	for i, d := range v {
+		b[i] = byte(d/10)<<4 | byte(d%10)
+	}
+
+	_, err := w.Write(b)
+	return err
+}
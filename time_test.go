@@ -0,0 +1,103 @@
+package binstruct
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TimeTag(t *testing.T) {
+	type dataStruct struct {
+		Created  time.Time     `bin:"time:unix32"`
+		Updated  time.Time     `bin:"time:unixms,le"`
+		Written  time.Time     `bin:"time:filetime,le"`
+		Modified time.Time     `bin:"time:dos,le,tz:+0200"`
+		Fix      time.Time     `bin:"time:gps"`
+		Meter    time.Time     `bin:"time:bcd,tz:+0800"`
+		Logged   time.Time     `bin:"time:bcd,len:7"`
+		Uptime   time.Duration `bin:"time:unix32"`
+		Timeout  time.Duration `bin:"time:unixms"`
+	}
+
+	data := []byte{
+		0x65, 0x92, 0x3D, 0x20, // 2024-01-01 04:18:40 UTC
+		0xE8, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 1 s after 1970
+		0x00, 0x80, 0x3E, 0xD5, 0xDE, 0xB1, 0x9D, 0x01, // 1970-01-01
+		0x7D, 0x5D, 0x5E, 0x49, // 2016-10-30 11:43:58 +0200
+		0x08, 0x00, 0x00, 0x00, 0x00, 0x3C, // week 2048, 60 s
+		0x25, 0x01, 0x31, 0x23, 0x59, 0x58, // 2025-01-31 23:59:58 +0800
+		0x19, 0x99, 0x12, 0x31, 0x00, 0x00, 0x01, // 1999-12-31 00:00:01
+		0x00, 0x00, 0x0E, 0x10, // 1h
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xF4, // 500ms
+	}
+
+	want := dataStruct{
+		Created:  time.Date(2024, 1, 1, 4, 18, 40, 0, time.UTC),
+		Updated:  time.Date(1970, 1, 1, 0, 0, 1, 0, time.UTC),
+		Written:  time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+		Modified: time.Date(2016, 10, 30, 11, 43, 58, 0, time.FixedZone("+0200", 2*3600)),
+		Fix:      time.Date(2019, 4, 7, 0, 1, 0, 0, time.UTC),
+		Meter:    time.Date(2025, 1, 31, 23, 59, 58, 0, time.FixedZone("+0800", 8*3600)),
+		Logged:   time.Date(1999, 12, 31, 0, 0, 1, 0, time.UTC),
+		Uptime:   time.Hour,
+		Timeout:  500 * time.Millisecond,
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.True(t, want.Created.Equal(actual.Created), actual.Created)
+	require.True(t, want.Updated.Equal(actual.Updated), actual.Updated)
+	require.True(t, want.Written.Equal(actual.Written), actual.Written)
+	require.True(t, want.Modified.Equal(actual.Modified), actual.Modified)
+	require.Equal(t, 11, actual.Modified.Hour())
+	require.True(t, want.Fix.Equal(actual.Fix), actual.Fix)
+	require.True(t, want.Meter.Equal(actual.Meter), actual.Meter)
+	require.True(t, want.Logged.Equal(actual.Logged), actual.Logged)
+	require.Equal(t, want.Uptime, actual.Uptime)
+	require.Equal(t, want.Timeout, actual.Timeout)
+
+	got, err := MarshalBE(want)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// Times are converted to the zone of the field
+	got, err = MarshalBE(struct {
+		Meter time.Time `bin:"time:bcd,tz:+0800"`
+	}{Meter: time.Date(2025, 1, 31, 15, 59, 58, 0, time.UTC)})
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x25, 0x01, 0x31, 0x23, 0x59, 0x58}, got)
+}
+
+func Test_TimeTagErrors(t *testing.T) {
+	var actual struct {
+		Date time.Time `bin:"time:bcd"`
+	}
+	err := UnmarshalBE([]byte{0x25, 0x02, 0x30, 0x00, 0x00, 0x00}, &actual)
+	require.EqualError(t, err, `failed set value to field "Date": invalid date 2025-02-30 00:00:00`)
+
+	err = UnmarshalBE([]byte{0x25, 0x0A, 0x01, 0x00, 0x00, 0x00}, &actual)
+	require.EqualError(t, err, `failed set value to field "Date": invalid bcd byte 0x0a at index 1`)
+
+	_, err = MarshalBE(struct {
+		Date time.Time `bin:"time:unix32"`
+	}{Date: time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)})
+	require.EqualError(t, err, `failed set value to field "Date": -86400 seconds are out of range for unix32`)
+
+	_, err = MarshalBE(struct {
+		Date time.Time `bin:"time:dos"`
+	}{Date: time.Date(1979, 1, 1, 0, 0, 0, 0, time.UTC)})
+	require.EqualError(t, err, `failed set value to field "Date": time 1979-01-01 00:00:00 +0000 UTC is out of range for dos`)
+
+	_, err = MarshalBE(struct {
+		Wait time.Duration `bin:"time:dos"`
+	}{})
+	require.EqualError(t, err, `failed set value to field "Wait": time:dos is not supported for time.Duration`)
+
+	_, err = MarshalBE(struct {
+		Date time.Time `bin:"time:unix"`
+	}{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid time unix, expected unix32, unix64, unixms, filetime, dos, gps or bcd")
+}
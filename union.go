@@ -0,0 +1,84 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// UnknownVariantError is returned when the discriminator of a union field
+// does not match any registered variant.
+type UnknownVariantError struct {
+	Union reflect.Type
+	Key   int64
+}
+
+func (e *UnknownVariantError) Error() string {
+	return fmt.Sprintf("binstruct: unknown variant %d for union %s", e.Key, e.Union)
+}
+
+type union struct {
+	variants map[int64]reflect.Type
+}
+
+var unions sync.Map // reflect.Type -> *union
+
+// RegisterUnion registers the concrete types an interface type T can hold.
+// A field of type T, or a slice or array of T, tagged with
+// bin:"switch:Kind" is decoded into the variant stored under the value of
+// Kind. Marshal writes the held value and checks that its type matches
+// the discriminator.
+//
+//	binstruct.RegisterUnion[Shape](map[int64]Shape{1: Circle{}, 2: Rect{}})
+//
+// Variants may be struct values or pointers to structs.
+func RegisterUnion[T any](variants map[int64]T) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Interface {
+		panic("binstruct: RegisterUnion type must be an interface, got " + t.String())
+	}
+
+	u := &union{variants: make(map[int64]reflect.Type, len(variants))}
+	for k, v := range variants {
+		vt := reflect.TypeOf(v)
+		if vt == nil {
+			panic(fmt.Sprintf("binstruct: RegisterUnion variant %d of %s is nil", k, t))
+		}
+		u.variants[k] = vt
+	}
+
+	unions.Store(t, u)
+}
+
+// unionVariant returns the concrete type registered for the interface
+// type t under the value of the switch expression.
+func unionVariant(t reflect.Type, env exprEnv, fieldData *fieldReadData) (reflect.Type, error) {
+	if fieldData.Switch == nil {
+		return nil, errors.New(`type "interface" not supported`)
+	}
+
+	u, ok := unions.Load(t)
+	if !ok {
+		return nil, errors.New("union " + t.String() + " is not registered, use binstruct.RegisterUnion")
+	}
+
+	key, err := fieldData.Switch.eval(env)
+	if err != nil {
+		return nil, fmt.Errorf("eval switch: %w", err)
+	}
+
+	variant, ok := u.(*union).variants[key]
+	if !ok {
+		return nil, &UnknownVariantError{Union: t, Key: key}
+	}
+
+	return variant, nil
+}
+
+func unionValueType(v reflect.Value) string {
+	if v.IsNil() {
+		return "<nil>"
+	}
+	return v.Elem().Type().String()
+}
@@ -0,0 +1,132 @@
+package binstruct
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type unionShape interface {
+	Area() int32
+}
+
+type unionCircle struct {
+	R int32
+}
+
+func (c unionCircle) Area() int32 { return 3 * c.R * c.R }
+
+type unionRect struct {
+	W, H int16
+}
+
+func (r *unionRect) Area() int32 { return int32(r.W) * int32(r.H) }
+
+func init() {
+	RegisterUnion[unionShape](map[int64]unionShape{
+		1: unionCircle{},
+		2: &unionRect{},
+	})
+}
+
+func Test_Union(t *testing.T) {
+	type item struct {
+		Kind  uint8
+		Shape unionShape `bin:"switch:Kind"`
+	}
+
+	type dataStruct struct {
+		Items  []item `bin:"len:2"`
+		Kind   uint8
+		Shapes []unionShape `bin:"len:2,switch:Kind"`
+	}
+
+	data := []byte{
+		0x01, 0x00, 0x00, 0x00, 0x02, // circle
+		0x02, 0x00, 0x03, 0x00, 0x04, // rect
+		0x02,                   // Kind
+		0x00, 0x01, 0x00, 0x02, // rect
+		0x00, 0x03, 0x00, 0x04, // rect
+	}
+
+	want := dataStruct{
+		Items: []item{
+			{Kind: 1, Shape: unionCircle{R: 2}},
+			{Kind: 2, Shape: &unionRect{W: 3, H: 4}},
+		},
+		Kind:   2,
+		Shapes: []unionShape{&unionRect{W: 1, H: 2}, &unionRect{W: 3, H: 4}},
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+	require.Equal(t, int32(12), actual.Items[0].Shape.Area())
+
+	got, err := MarshalBE(actual)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func Test_UnionUnknownVariant(t *testing.T) {
+	type dataStruct struct {
+		Kind  uint8
+		Shape unionShape `bin:"switch:Kind"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x07, 0x00}, &actual)
+	require.EqualError(t, err, `failed set value to field "Shape": binstruct: unknown variant 7 for union binstruct.unionShape`)
+
+	var variantErr *UnknownVariantError
+	require.True(t, errors.As(err, &variantErr))
+	require.Equal(t, int64(7), variantErr.Key)
+}
+
+func Test_UnionMarshalMismatch(t *testing.T) {
+	type dataStruct struct {
+		Kind  uint8
+		Shape unionShape `bin:"switch:Kind"`
+	}
+
+	_, err := MarshalBE(dataStruct{Kind: 1, Shape: &unionRect{}})
+	require.EqualError(t, err, `failed set value to field "Shape": union value of type *binstruct.unionRect does not match variant binstruct.unionCircle`)
+}
+
+func Test_UnionNotRegistered(t *testing.T) {
+	type notRegistered interface{}
+	type dataStruct struct {
+		Kind  uint8
+		Value notRegistered `bin:"switch:Kind"`
+	}
+
+	var actual dataStruct
+	err := UnmarshalBE([]byte{0x01}, &actual)
+	require.EqualError(t, err, `failed set value to field "Value": union binstruct.notRegistered is not registered, use binstruct.RegisterUnion`)
+}
+
+func Test_UnionElementTags(t *testing.T) {
+	type dataStruct struct {
+		Kind   uint8
+		Shapes []unionShape `bin:"len:2,switch:Kind,[if:1]"`
+	}
+
+	data := []byte{
+		0x01,
+		0x00, 0x00, 0x00, 0x01, // circle
+		0x00, 0x00, 0x00, 0x02, // circle
+	}
+
+	want := dataStruct{Kind: 1, Shapes: []unionShape{unionCircle{R: 1}, unionCircle{R: 2}}}
+
+	var actual dataStruct
+	err := UnmarshalBE(data, &actual)
+	require.NoError(t, err)
+	require.Equal(t, want, actual)
+
+	got, err := MarshalBE(actual)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
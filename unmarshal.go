@@ -1,14 +1,17 @@
 package binstruct
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 )
 
 type unmarshal struct {
-	r Reader
+	r    Reader
+	nest *nesting
 }
 
 // An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
@@ -38,26 +41,48 @@ func (u *unmarshal) unmarshal(v interface{}, parentStructValues []reflect.Value)
 		return &InvalidUnmarshalError{reflect.TypeOf(v)}
 	}
 
-	structValue := rv.Elem()
-	numField := structValue.NumField()
+	return u.unmarshalStruct(rv.Elem(), parentStructValues)
+}
+
+func (u *unmarshal) unmarshalStruct(structValue reflect.Value, parentStructValues []reflect.Value) error {
+	err := u.nest.enter()
+	if err != nil {
+		return err
+	}
+	defer u.nest.leave()
+
+	plan, err := getStructPlan(structValue.Type())
+	if err != nil {
+		return err
+	}
 
-	valueType := structValue.Type()
-	for i := 0; i < numField; i++ {
-		fieldType := valueType.Field(i)
-		tags, err := parseTag(fieldType.Tag.Get(tagName))
+	var structStart int64
+	if plan.hasPadding {
+		structStart, err = u.r.Seek(0, io.SeekCurrent)
 		if err != nil {
-			return fmt.Errorf(`failed parseTag for field "%s": %w`, fieldType.Name, err)
+			return err
 		}
+	}
 
-		fieldData, err := parseReadDataFromTags(structValue, tags)
-		if err != nil {
-			return fmt.Errorf(`failed parse ReadData from tags for field "%s": %w`, fieldType.Name, err)
+	for i := 0; i < len(plan.fields); i++ {
+		f := plan.fields[i]
+		if g := f.bitGroup; g != nil {
+			err = u.readBitGroup(plan, g, structValue)
+			if err != nil {
+				return err
+			}
+
+			i += len(g.fields) - 1
+			continue
 		}
 
-		fieldValue := structValue.Field(i)
-		err = u.setValueToField(structValue, fieldValue, fieldData, parentStructValues)
+		if f.data.hasPadding() {
+			err = u.setPaddedField(structStart, structValue, f, parentStructValues)
+		} else {
+			err = u.setValueToField(structValue, structValue.Field(f.index), f.data, parentStructValues)
+		}
 		if err != nil {
-			return fmt.Errorf(`failed set value to field "%s": %w`, fieldType.Name, err)
+			return fieldError(err, `failed set value to field "%s"`, f.name)
 		}
 	}
 
@@ -74,21 +99,42 @@ func (u *unmarshal) setValueToField(structValue, fieldValue reflect.Value, field
 		return nil
 	}
 
+	env := exprEnv{structValue, parentStructValues}
+	skip, err := fieldData.skip(env)
+	if err != nil || skip {
+		return err
+	}
+
+	if fieldValue.Kind() == reflect.Ptr && fieldValue.Type() != bigIntType {
+		return u.setPointer(structValue, fieldValue, fieldData, parentStructValues)
+	}
+
 	r := u.r
 	if fieldData.Order != nil {
 		r = r.WithOrder(fieldData.Order)
 	}
 
-	err := setOffset(r, fieldData)
+	err = setOffset(r, env, fieldData)
 	if err != nil {
 		return fmt.Errorf("set offset: %w", err)
 	}
 
+	if fieldData.Size != nil {
+		return u.readSized(r, env, structValue, fieldValue, fieldData, parentStructValues)
+	}
+
+	if fieldData.Magic != nil {
+		err = checkMagic(r, fieldData.Magic)
+		if err != nil {
+			return err
+		}
+	}
+
 	if fieldData.FuncName != "" && !IsInnerFunction(fieldData.FuncName) {
 		var okCallFunc bool
 		okCallFunc, err = callDecodeFunc(r, fieldData.FuncName, structValue, fieldValue)
 		if err != nil {
-			return fmt.Errorf("call custom func(%s): %w", structValue.Type().Name(), err)
+			return wrapError(err, "call custom func(%s)", structValue.Type().Name())
 		}
 
 		if !okCallFunc {
@@ -97,7 +143,7 @@ func (u *unmarshal) setValueToField(structValue, fieldValue reflect.Value, field
 				sv := parentStructValues[i]
 				okCallFunc, err = callDecodeFunc(r, fieldData.FuncName, sv, fieldValue)
 				if err != nil {
-					return fmt.Errorf("call custom func from parent(%s): %w", sv.Type().Name(), err)
+					return wrapError(err, "call custom func from parent(%s)", sv.Type().Name())
 				}
 
 				if okCallFunc {
@@ -122,13 +168,49 @@ or
 		return nil
 	}
 
+	length, err := fieldData.evalLength(env)
+	if err != nil {
+		return fmt.Errorf("eval len: %w", err)
+	}
+
+	if fieldData.Prefix != "" {
+		length, err = readPrefix(r, fieldValue, fieldData.Prefix)
+		if err != nil {
+			return err
+		}
+	}
+
+	if fieldData.Varint {
+		return readVarint(r, fieldValue, fieldData)
+	}
+
+	if fieldData.BCD {
+		return readBCD(r, fieldValue, fieldData, length)
+	}
+
+	if fieldData.Time != "" {
+		return readTime(r, fieldValue, fieldData, length)
+	}
+
+	if isBigIntType(fieldValue.Type()) {
+		return readBigInt(r, fieldValue, fieldData, length)
+	}
+
+	if fieldData.Float16 != "" {
+		return readFloat16(r, fieldValue, fieldData)
+	}
+
+	if fieldData.scaled() {
+		return readScaled(r, fieldValue, fieldData, length)
+	}
+
 	switch fieldValue.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		var value int64
 		var err error
 
-		if fieldData.Length != nil {
-			value, err = r.ReadIntX(int(*fieldData.Length))
+		if length != nil {
+			value, err = r.ReadIntX(int(*length))
 		} else {
 			switch fieldValue.Kind() {
 			case reflect.Int8:
@@ -163,8 +245,8 @@ or
 		var value uint64
 		var err error
 
-		if fieldData.Length != nil {
-			value, err = r.ReadUintX(int(*fieldData.Length))
+		if length != nil {
+			value, err = r.ReadUintX(int(*length))
 		} else {
 			switch fieldValue.Kind() {
 			case reflect.Uint8:
@@ -223,24 +305,69 @@ or
 			fieldValue.SetBool(b)
 		}
 	case reflect.String:
-		if fieldData.Length == nil {
+		enc, err := getTextEncoding(fieldData.Encoding)
+		if err != nil {
+			return err
+		}
+
+		var b []byte
+		switch {
+		case fieldData.Terminator != nil:
+			b, err = readTerminated(r, env, fieldData, enc.unitSize())
+		case fieldData.Greedy:
+			b, err = r.ReadAll()
+		case length != nil:
+			_, b, err = r.ReadBytes(int(*length))
+			if fieldData.Trim {
+				b = trimFill(b, fieldData.Fill, enc.unitSize())
+			}
+		default:
 			return errors.New("need set tag with len for string")
 		}
+		if err != nil {
+			return err
+		}
 
-		_, b, err := r.ReadBytes(int(*fieldData.Length))
+		str, err := enc.decodeString(b)
 		if err != nil {
 			return err
 		}
 
 		if fieldValue.CanSet() {
-			fieldValue.SetString(string(b))
+			fieldValue.SetString(str)
 		}
 	case reflect.Slice:
-		if fieldData.Length == nil {
+		isBytes := fieldValue.Type().Elem().Kind() == reflect.Uint8 && fieldData.ElemFieldData == nil
+		if isBytes && (fieldData.Terminator != nil || fieldData.Greedy) {
+			var b []byte
+			if fieldData.Greedy {
+				b, err = r.ReadAll()
+			} else {
+				b, err = readTerminated(r, env, fieldData, 1)
+			}
+			if err != nil {
+				return err
+			}
+
+			if fieldValue.CanSet() {
+				fieldValue.SetBytes(b)
+			}
+			return nil
+		}
+
+		if fieldData.Greedy {
+			return u.readGreedy(structValue, fieldValue, fieldData, parentStructValues)
+		}
+
+		if fieldData.Until != nil {
+			return u.readUntil(structValue, fieldValue, fieldData, parentStructValues)
+		}
+
+		if length == nil {
 			return errors.New("need set tag with len for slice")
 		}
 
-		for i := int64(0); i < *fieldData.Length; i++ {
+		for i := int64(0); i < *length; i++ {
 			tmpV := reflect.New(fieldValue.Type().Elem()).Elem()
 			err = u.setValueToField(structValue, tmpV, fieldData.ElemFieldData, parentStructValues)
 			if err != nil {
@@ -253,8 +380,8 @@ or
 	case reflect.Array:
 		var arrLen int64
 
-		if fieldData.Length != nil {
-			arrLen = *fieldData.Length
+		if length != nil {
+			arrLen = *length
 		}
 
 		if arrLen == 0 {
@@ -271,10 +398,38 @@ or
 				fieldValue.Index(int(i)).Set(tmpV)
 			}
 		}
+	case reflect.Map:
+		if length == nil {
+			return errors.New("need set tag with len or prefix for map")
+		}
+
+		return u.readMap(structValue, fieldValue, fieldData, *length, parentStructValues)
 	case reflect.Struct:
-		err = u.unmarshal(fieldValue.Addr().Interface(), append(parentStructValues, structValue))
+		err = u.unmarshalStruct(fieldValue, append(parentStructValues, structValue))
+		if err != nil {
+			return wrapError(err, "unmarshal struct")
+		}
+	case reflect.Interface:
+		variant, err := unionVariant(fieldValue.Type(), env, fieldData)
 		if err != nil {
-			return fmt.Errorf("unmarshal struct: %w", err)
+			return err
+		}
+
+		// Pointer variants are allocated and their target is decoded
+		value := reflect.New(variant).Elem()
+		target := value
+		if variant.Kind() == reflect.Ptr {
+			value = reflect.New(variant.Elem())
+			target = value.Elem()
+		}
+
+		err = u.setValueToField(structValue, target, nil, parentStructValues)
+		if err != nil {
+			return wrapError(err, "unmarshal %s", variant)
+		}
+
+		if fieldValue.CanSet() {
+			fieldValue.Set(value)
 		}
 	default:
 		return errors.New(`type "` + fieldValue.Kind().String() + `" not supported`)
@@ -284,12 +439,17 @@ or
 }
 
 func callDecodeFunc(r Reader, funcName string, structValue, fieldValue reflect.Value) (bool, error) {
+	plan, err := getStructPlan(structValue.Type())
+	if err != nil {
+		return false, err
+	}
+
 	// Call methods
-	m := structValue.Addr().MethodByName(funcName + "Decode")
+	m, ok := plan.decodeMethod(funcName)
 
 	readerType := reflect.TypeOf((*Reader)(nil)).Elem()
-	if m.IsValid() && m.Type().NumIn() == 1 && m.Type().In(0) == readerType {
-		ret := m.Call([]reflect.Value{reflect.ValueOf(r)})
+	if ok && m.Type.NumIn() == 2 && m.Type.In(1) == readerType {
+		ret := m.Func.Call([]reflect.Value{structValue.Addr(), reflect.ValueOf(r)})
 
 		errorType := reflect.TypeOf((*error)(nil)).Elem()
 
@@ -318,9 +478,34 @@ func callDecodeFunc(r Reader, funcName string, structValue, fieldValue reflect.V
 	return false, nil
 }
 
-func setOffset(r Reader, fieldData *fieldReadData) error {
+// checkMagic compares the next bytes with magic without consuming them,
+// the field itself is decoded as usual afterwards.
+func checkMagic(r Reader, magic []byte) error {
+	offset, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("seek: %w", err)
+	}
+
+	b, err := r.Peek(len(magic))
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(b, magic) {
+		return &MagicMismatchError{Offset: offset, Want: magic, Got: b}
+	}
+
+	return nil
+}
+
+func setOffset(r Reader, env exprEnv, fieldData *fieldReadData) error {
 	for _, v := range fieldData.Offsets {
-		_, err := r.Seek(v.Offset, v.Whence)
+		offset, err := v.Offset.eval(env)
+		if err != nil {
+			return fmt.Errorf("eval offset: %w", err)
+		}
+
+		_, err = r.Seek(offset, v.Whence)
 		if err != nil {
 			return fmt.Errorf("seek: %w", err)
 		}
@@ -0,0 +1,159 @@
+package binstruct
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// untilMatch evaluates the until tag against a slice element. The element
+// is the current value of the expression, the struct holding the slice is
+// its _parent.
+func (d *fieldReadData) untilMatch(elem, structValue reflect.Value, parentStructValues []reflect.Value) (bool, error) {
+	env := exprEnv{elem, append(parentStructValues[:len(parentStructValues):len(parentStructValues)], structValue)}
+	v, err := d.Until.eval(env)
+	if err != nil {
+		return false, fmt.Errorf("eval until: %w", err)
+	}
+	return v != 0, nil
+}
+
+// readUntil decodes slice elements up to and including the first one that
+// matches the until tag. The sentinel is dropped if untilExclude is set.
+func (u *unmarshal) readUntil(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
+	for i := 0; ; i++ {
+		tmpV := reflect.New(fieldValue.Type().Elem()).Elem()
+		err := u.setValueToField(structValue, tmpV, fieldData.ElemFieldData, parentStructValues)
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("element %d, no sentinel before end of input: %w", i, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return err
+		}
+
+		match, err := fieldData.untilMatch(tmpV, structValue, parentStructValues)
+		if err != nil {
+			return err
+		}
+
+		if (!match || !fieldData.UntilExclude) && fieldValue.CanSet() {
+			fieldValue.Set(reflect.Append(fieldValue, tmpV))
+		}
+
+		if match {
+			return nil
+		}
+	}
+}
+
+// untilElements returns the elements Marshal writes for a slice with an
+// until tag: the slice itself, followed by a zero sentinel if the last
+// element does not match.
+func untilElements(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) ([]reflect.Value, error) {
+	elems := make([]reflect.Value, 0, fieldValue.Len()+1)
+	for i := 0; i < fieldValue.Len(); i++ {
+		elem := fieldValue.Index(i)
+		match, err := fieldData.untilMatch(elem, structValue, parentStructValues)
+		if err != nil {
+			return nil, err
+		}
+
+		last := i == fieldValue.Len()-1
+		if match && (!last || fieldData.UntilExclude) {
+			return nil, fmt.Errorf("element %d matches until, it would end the slice", i)
+		}
+
+		elems = append(elems, elem)
+		if match {
+			return elems, nil
+		}
+	}
+
+	sentinel := untilSentinel(fieldValue.Type().Elem(), fieldData.Until)
+	match, err := fieldData.untilMatch(sentinel, structValue, parentStructValues)
+	if err != nil {
+		return nil, err
+	}
+
+	if !match {
+		return nil, errors.New("last element does not match until and the zero value can't be used as the sentinel")
+	}
+
+	return append(elems, sentinel), nil
+}
+
+// untilSentinel returns the element Marshal appends when the last element
+// does not match. It is N for integer elements with until:_==N, the value
+// Unmarshal stopped at, and the zero value otherwise.
+func untilSentinel(t reflect.Type, until expr) reflect.Value {
+	v := reflect.New(t).Elem()
+
+	e, ok := until.(*binaryExpr)
+	if !ok || e.op != "==" {
+		return v
+	}
+
+	x, y := e.x, e.y
+	if isSelfExpr(y) {
+		x, y = y, x
+	}
+
+	n, ok := constValue(y)
+	if !ok || !isSelfExpr(x) {
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !v.OverflowInt(n) {
+			v.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n >= 0 && !v.OverflowUint(uint64(n)) {
+			v.SetUint(uint64(n))
+		}
+	}
+	return v
+}
+
+// isSelfExpr reports whether e is _, the value the expression is
+// evaluated against.
+func isSelfExpr(e expr) bool {
+	f, ok := e.(fieldExpr)
+	return ok && len(f) == 1 && f[0] == exprSelf
+}
+
+func (m *marshal) writeUntil(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) error {
+	elems, err := untilElements(structValue, fieldValue, fieldData, parentStructValues)
+	if err != nil {
+		return err
+	}
+
+	for _, elem := range elems {
+		err = m.setValueToField(structValue, elem, fieldData.ElemFieldData, parentStructValues)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *marshal) untilLength(structValue, fieldValue reflect.Value, fieldData *fieldReadData, parentStructValues []reflect.Value) (int, error) {
+	elems, err := untilElements(structValue, fieldValue, fieldData, parentStructValues)
+	if err != nil {
+		return 0, err
+	}
+
+	sum := 0
+	for _, elem := range elems {
+		n, err := m.getValueLength(structValue, elem, fieldData.ElemFieldData, parentStructValues)
+		if err != nil {
+			return 0, err
+		}
+		sum += n
+	}
+
+	return sum, nil
+}
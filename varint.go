@@ -0,0 +1,107 @@
+package binstruct
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+func checkVarintKind(fieldValue reflect.Value, fieldData *fieldReadData) error {
+	switch fieldValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if fieldData.ZigZag {
+			return errors.New(`zigzag is not supported for type "` + fieldValue.Kind().String() + `"`)
+		}
+		return nil
+	default:
+		return errors.New(`varint is not supported for type "` + fieldValue.Kind().String() + `"`)
+	}
+}
+
+// readVarint decodes a varint integer field. Without zigzag a signed
+// value is the two's complement of the varint, as in protobuf int64.
+func readVarint(r Reader, fieldValue reflect.Value, fieldData *fieldReadData) error {
+	err := checkVarintKind(fieldValue, fieldData)
+	if err != nil {
+		return err
+	}
+
+	var u uint64
+	var i int64
+	if fieldData.ZigZag {
+		i, err = r.ReadVarint()
+		u = uint64(i)
+	} else {
+		u, err = r.ReadUvarint()
+		i = int64(u)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if fieldValue.OverflowUint(u) {
+			return fmt.Errorf("varint %d overflows %s", u, fieldValue.Type())
+		}
+
+		if fieldValue.CanSet() {
+			fieldValue.SetUint(u)
+		}
+	default:
+		if fieldValue.OverflowInt(i) {
+			return fmt.Errorf("varint %d overflows %s", i, fieldValue.Type())
+		}
+
+		if fieldValue.CanSet() {
+			fieldValue.SetInt(i)
+		}
+	}
+
+	return nil
+}
+
+// varintValue returns the unsigned value a varint integer field is
+// encoded as.
+func varintValue(fieldValue reflect.Value, fieldData *fieldReadData) (uint64, error) {
+	err := checkVarintKind(fieldValue, fieldData)
+	if err != nil {
+		return 0, err
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fieldValue.Uint(), nil
+	default:
+		i := fieldValue.Int()
+		if fieldData.ZigZag {
+			return uint64(i<<1) ^ uint64(i>>63), nil
+		}
+		return uint64(i), nil
+	}
+}
+
+func writeVarint(w Writer, fieldValue reflect.Value, fieldData *fieldReadData) error {
+	u, err := varintValue(fieldValue, fieldData)
+	if err != nil {
+		return err
+	}
+
+	return w.WriteUvarint(u)
+}
+
+func varintLength(fieldValue reflect.Value, fieldData *fieldReadData) (int, error) {
+	u, err := varintValue(fieldValue, fieldData)
+	if err != nil {
+		return 0, err
+	}
+
+	return uvarintSize(u), nil
+}
+
+func uvarintSize(u uint64) int {
+	return len(binary.AppendUvarint(nil, u))
+}
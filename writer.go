@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"math"
+	"math/big"
 )
 
 var (
@@ -30,9 +32,28 @@ type Writer interface {
 	WriteInt64(v int64) error
 	WriteIntX(v int64, x int) error
 
+	// WriteUvarint writes v as an unsigned LEB128 varint
+	WriteUvarint(v uint64) error
+	// WriteVarint writes v as a zigzag encoded varint
+	WriteVarint(v int64) error
+
+	// WriteBigInt writes v in n bytes, two's complement if signed
+	WriteBigInt(v *big.Int, n int, signed bool) error
+
+	// WriteFloat16 writes v as IEEE 754 half precision, rounded to nearest even
+	WriteFloat16(v float32) error
+	// WriteBFloat16 writes v as bfloat16, rounded to nearest even
+	WriteBFloat16(v float32) error
 	WriteFloat32(v float32) error
 	WriteFloat64(v float64) error
 
+	// WriteBits writes the n low bits of v (up to 64) in the writer bit
+	// order. Bits are buffered until a byte is complete; byte writes and
+	// Flush pad the pending byte with zero bits.
+	WriteBits(v uint64, n int) error
+	// Flush writes the pending bits of a partially filled byte
+	Flush() error
+
 	Bytes() []byte
 
 	// Marshal parses the binary data and stores the result
@@ -41,26 +62,27 @@ type Writer interface {
 
 	// WithOrder changes the byte order for the new Reader
 	WithOrder(order binary.ByteOrder) Writer
+	// WithBitOrder changes the bit order of WriteBits for the new Writer
+	WithBitOrder(order BitOrder) Writer
 }
 
 func NewWriterWithBuffer(buffer *bytes.Buffer, order binary.ByteOrder, debug bool) Writer {
-	if order == nil {
-		order = binary.BigEndian
-	}
-	return &writer{
-		buffer: buffer,
-		order:  order,
-		debug:  debug,
-	}
+	return newWriter(buffer, order, debug)
 }
 
 func NewWriter(order binary.ByteOrder, debug bool) Writer {
+	return newWriter(bytes.NewBuffer(make([]byte, 0, 1024)), order, debug)
+}
+
+func newWriter(buffer *bytes.Buffer, order binary.ByteOrder, debug bool) *writer {
 	if order == nil {
 		order = binary.BigEndian
 	}
 	return &writer{
-		buffer: bytes.NewBuffer(make([]byte, 0, 1024)),
+		buffer: buffer,
 		order:  order,
+		bits:   &bitState{},
+		nest:   &nesting{max: DefaultMaxDepth},
 		debug:  debug,
 	}
 }
@@ -69,59 +91,108 @@ type writer struct {
 	buffer *bytes.Buffer
 	order  binary.ByteOrder
 
+	bitOrder BitOrder
+	bits     *bitState // count is the bits used in buf
+
+	nest  *nesting
 	debug bool
 }
 
 func (w *writer) Write(p []byte) (n int, err error) {
+	err = w.Flush()
+	if err != nil {
+		return 0, err
+	}
 	return w.buffer.Write(p)
 }
 
 func (w *writer) WriteByte(c byte) error {
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
 	return w.buffer.WriteByte(c)
 }
 
-func (w *writer) WriteUintX(v uint64, x int) error {
-	if x > 8 {
-		errors.New("cannot write more than 8 bytes for custom length (u)int")
+func (w *writer) WriteBits(v uint64, n int) error {
+	if n < 0 {
+		return ErrNegativeCount
 	}
 
-	switch w.order {
-	case binary.BigEndian:
-		for i := 0; i < x; i++ {
-			err := w.WriteByte(byte(v >> (8 * (x - i - 1))))
-			if err != nil {
-				return err
-			}
+	if n > 64 {
+		return errors.New("cannot write more than 64 bits")
+	}
+
+	for i := 0; i < n; i++ {
+		if w.bitOrder == LSBFirst {
+			w.bits.buf |= byte(v>>i&1) << w.bits.count
+		} else {
+			w.bits.buf |= byte(v>>(n-1-i)&1) << (7 - w.bits.count)
 		}
-	case binary.LittleEndian:
-		for i := 0; i < x; i++ {
-			err := w.WriteByte(byte(v >> (8 * i)))
+
+		w.bits.count++
+		if w.bits.count == 8 {
+			err := w.Flush()
 			if err != nil {
 				return err
 			}
 		}
 	}
+
 	return nil
 }
 
+func (w *writer) Flush() error {
+	if w.bits.count == 0 {
+		return nil
+	}
+
+	b := w.bits.buf
+	w.bits.buf = 0
+	w.bits.count = 0
+	return w.buffer.WriteByte(b)
+}
+
+func (w *writer) WriteUintX(v uint64, x int) error {
+	if x > 8 {
+		return errors.New("cannot write more than 8 bytes for custom length (u)int")
+	}
+
+	b := make([]byte, x)
+	for i := range b {
+		b[i] = byte(v >> (8 * (x - i - 1)))
+	}
+
+	b, err := fromBigEndian(w.order, b)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
 func (w *writer) WriteUint8(v uint8) error {
-	return w.buffer.WriteByte(v)
+	return w.WriteByte(v)
 }
 
 func (w *writer) WriteUint16(v uint16) error {
 	b := make([]byte, 2)
 	w.order.PutUint16(b, v)
-	err := w.buffer.WriteByte(b[0])
+	n, err := w.Write(b)
 	if err != nil {
 		return err
 	}
-	return w.buffer.WriteByte(b[1])
+	if n != 2 {
+		return ErrCantWriter
+	}
+	return nil
 }
 
 func (w *writer) WriteUint32(v uint32) error {
 	b := make([]byte, 4)
 	w.order.PutUint32(b, v)
-	n, err := w.buffer.Write(b)
+	n, err := w.Write(b)
 	if err != nil {
 		return err
 	}
@@ -134,11 +205,11 @@ func (w *writer) WriteUint32(v uint32) error {
 func (w *writer) WriteUint64(v uint64) error {
 	b := make([]byte, 8)
 	w.order.PutUint64(b, v)
-	n, err := w.buffer.Write(b)
+	n, err := w.Write(b)
 	if err != nil {
 		return err
 	}
-	if n != 4 {
+	if n != 8 {
 		return ErrCantWriter
 	}
 	return nil
@@ -171,6 +242,54 @@ func (w *writer) WriteIntX(v int64, x int) error {
 	return w.WriteUintX(u, x)
 }
 
+func (w *writer) WriteUvarint(v uint64) error {
+	_, err := w.Write(binary.AppendUvarint(nil, v))
+	return err
+}
+
+func (w *writer) WriteVarint(v int64) error {
+	_, err := w.Write(binary.AppendVarint(nil, v))
+	return err
+}
+
+func (w *writer) WriteBigInt(v *big.Int, n int, signed bool) error {
+	if v == nil {
+		return errors.New("cannot write nil big int")
+	}
+
+	bits := 8 * n
+	if signed {
+		bits--
+	}
+
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	if v.Cmp(limit) >= 0 || (v.Sign() < 0 && (!signed || v.Cmp(new(big.Int).Neg(limit)) < 0)) {
+		return fmt.Errorf("value %s does not fit in %d bytes", v, n)
+	}
+
+	u := v
+	if v.Sign() < 0 {
+		u = new(big.Int).Add(v, new(big.Int).Lsh(big.NewInt(1), uint(8*n)))
+	}
+
+	b := u.FillBytes(make([]byte, n))
+	b, err := fromBigEndian(w.order, b)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+func (w *writer) WriteFloat16(v float32) error {
+	return w.WriteUint16(float32ToFloat16(v))
+}
+
+func (w *writer) WriteBFloat16(v float32) error {
+	return w.WriteUint16(float32ToBFloat16(v))
+}
+
 func (w *writer) WriteFloat32(v float32) error {
 	u := math.Float32bits(v)
 	return w.WriteUint32(u)
@@ -186,10 +305,28 @@ func (w *writer) Bytes() []byte {
 }
 
 func (w *writer) Marshal(v any) ([]byte, error) {
-	m := &marshal{w: w}
+	m := newMarshal(w)
 	return m.Marshal(v)
 }
 
 func (w *writer) WithOrder(order binary.ByteOrder) Writer {
-	return NewWriterWithBuffer(w.buffer, order, w.debug)
+	return &writer{
+		buffer:   w.buffer,
+		order:    order,
+		bitOrder: w.bitOrder,
+		bits:     w.bits,
+		nest:     w.nest,
+		debug:    w.debug,
+	}
+}
+
+func (w *writer) WithBitOrder(order BitOrder) Writer {
+	return &writer{
+		buffer:   w.buffer,
+		order:    w.order,
+		bitOrder: order,
+		bits:     w.bits,
+		nest:     w.nest,
+		debug:    w.debug,
+	}
 }
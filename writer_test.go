@@ -0,0 +1,61 @@
+package binstruct
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WriteBits(t *testing.T) {
+	w := NewWriter(binary.BigEndian, false)
+
+	require.NoError(t, w.WriteBits(5, 3))
+	require.NoError(t, w.WriteBits(0x153, 9))
+	require.Equal(t, []byte{0xb5}, w.Bytes())
+
+	require.NoError(t, w.Flush())
+	require.Equal(t, []byte{0xb5, 0x30}, w.Bytes())
+
+	require.NoError(t, w.Flush()) // nothing pending
+	require.Equal(t, []byte{0xb5, 0x30}, w.Bytes())
+}
+
+func Test_WriteBitsLSBFirst(t *testing.T) {
+	w := NewWriter(binary.BigEndian, false).WithBitOrder(LSBFirst)
+
+	require.NoError(t, w.WriteBits(5, 3))
+	require.NoError(t, w.WriteBits(0x196, 9))
+
+	// byte writes flush the pending bits first
+	require.NoError(t, w.WriteByte(0xff))
+	require.Equal(t, []byte{0xb5, 0x0c, 0xff}, w.Bytes())
+}
+
+func Test_WriteBitsDerivedWriter(t *testing.T) {
+	w := NewWriter(binary.BigEndian, false)
+
+	require.NoError(t, w.WriteBits(0xa, 4))
+	require.NoError(t, w.WithOrder(binary.LittleEndian).WriteBits(0xb, 4))
+	require.NoError(t, w.WriteBits(7, 3))
+
+	// the derived writer flushes the bits pending in the parent
+	require.NoError(t, w.WithOrder(binary.LittleEndian).WriteUint16(0x0102))
+	require.Equal(t, []byte{0xab, 0xe0, 0x02, 0x01}, w.Bytes())
+}
+
+func Test_WriteUint64(t *testing.T) {
+	w := NewWriter(binary.BigEndian, false)
+
+	require.NoError(t, w.WriteUint64(0x0102030405060708))
+	require.Equal(t, []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, w.Bytes())
+}
+
+func Test_WriteVarint(t *testing.T) {
+	w := NewWriter(binary.BigEndian, false)
+
+	require.NoError(t, w.WriteUvarint(150))
+	require.NoError(t, w.WriteVarint(-2))
+	require.NoError(t, w.WriteVarint(63))
+	require.Equal(t, []byte{0x96, 0x01, 0x03, 0x7e}, w.Bytes())
+}